@@ -0,0 +1,51 @@
+package mmap
+
+// Advice is a hint about how a mapping will be accessed.
+type Advice int
+
+const (
+	// AdviceNormal restores the default read-ahead behaviour.
+	AdviceNormal Advice = iota
+	// AdviceRandom expects page references in random order.
+	AdviceRandom
+	// AdviceSequential expects page references in sequential order.
+	AdviceSequential
+	// AdviceWillNeed expects access in the near future and starts
+	// reading the pages in.
+	AdviceWillNeed
+	// AdviceDontNeed hands the pages back to the system. The contents of
+	// anonymous memory must be considered lost (Linux reads them back as
+	// zero); file and shared memory pages are read back from their
+	// backing store.
+	AdviceDontNeed
+)
+
+// Advise gives the system advice about the use of the mapping. On Windows
+// only AdviceDontNeed on anonymous memory has an effect.
+func (f *MapFile) Advise(advice Advice) error {
+	if f == nil {
+		return &MapError{Op: "MapFile.Advise", Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return f.error("Advise", 0, 0, ErrClosed)
+	}
+	if err := advise(f.data, advice, false); err != nil {
+		return f.error("Advise", 0, len(f.data), err)
+	}
+	return nil
+}
+
+// Advise gives the system advice about the use of the mapping. On Windows
+// only AdviceDontNeed on anonymous memory has an effect.
+func (f *MapMem) Advise(advice Advice) error {
+	if f == nil {
+		return &MapError{Op: "MapMem.Advise", Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return f.error("Advise", 0, 0, ErrClosed)
+	}
+	if err := advise(f.mapping(), advice, f.anon); err != nil {
+		return f.error("Advise", 0, len(f.data), err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd
+
+package mmap
+
+import (
+	"os"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+func advise(b []byte, advice Advice, anon bool) error {
+	var flag int
+	switch advice {
+	case AdviceNormal:
+		flag = syscall.MADV_NORMAL
+	case AdviceRandom:
+		flag = syscall.MADV_RANDOM
+	case AdviceSequential:
+		flag = syscall.MADV_SEQUENTIAL
+	case AdviceWillNeed:
+		flag = syscall.MADV_WILLNEED
+	case AdviceDontNeed:
+		flag = syscall.MADV_DONTNEED
+	default:
+		return ErrInvalid
+	}
+	if err := syscall.Madvise(b, flag); err != nil {
+		return os.NewSyscallError("madvise", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package mmap
+
+import (
+	"os"
+
+	"github.com/godcong/mmap/unsafex"
+	syscall "golang.org/x/sys/windows"
+)
+
+func advise(b []byte, advice Advice, anon bool) error {
+	switch advice {
+	case AdviceNormal, AdviceRandom, AdviceSequential, AdviceWillNeed:
+		return nil
+	case AdviceDontNeed:
+		if !anon {
+			return nil
+		}
+		_, err := syscall.VirtualAlloc(unsafex.BytesToPtr(b), uintptr(len(b)), syscall.MEM_RESET, syscall.PAGE_READWRITE)
+		if err != nil {
+			return os.NewSyscallError("VirtualAlloc", err)
+		}
+		return nil
+	}
+	return ErrInvalid
+}
@@ -0,0 +1,16 @@
+package mmap
+
+// OpenAnon maps size bytes of anonymous private memory, rounded up to the
+// page size. The memory lives outside the Go heap, so the garbage collector
+// never scans it, and it is zeroed when mapped. The returned MapMem is
+// writable and has ID zero; it is not shared with other processes.
+//
+// WithHugePages, WithTransparentHugePages, WithPopulate and WithLogger
+// apply to anonymous memory. Use Advise(AdviceDontNeed) to hand unused
+// memory back to the system without unmapping it.
+func OpenAnon(size int, opts ...Option) (*MapMem, error) {
+	if size <= 0 {
+		return nil, &MapError{Op: "MapMem.OpenAnon", Len: size, Err: ErrInvalid}
+	}
+	return openAnon(roundUp(size, pageSize), newOptions(opts))
+}
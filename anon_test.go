@@ -0,0 +1,86 @@
+package mmap_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestOpenAnon(t *testing.T) {
+	if _, err := mmap.OpenAnon(0); !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+
+	m, err := mmap.OpenAnon(100)
+	if err != nil {
+		t.Fatalf("could not map memory: %+v", err)
+	}
+	defer m.Close()
+	if got, want := m.Len(), os.Getpagesize(); got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+	if !m.IsOwner() || m.ID() != 0 {
+		t.Fatalf("invalid handle: owner=%v, id=%d", m.IsOwner(), m.ID())
+	}
+
+	if _, err := m.Write([]byte("hello world")); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	if _, err := m.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("could not seek: %+v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(m, buf); err != nil {
+		t.Fatalf("could not read: %+v", err)
+	}
+	if got, want := buf, []byte("hello"); !bytes.Equal(got, want) {
+		t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+	}
+
+	for _, advice := range []mmap.Advice{mmap.AdviceSequential, mmap.AdviceWillNeed, mmap.AdviceNormal} {
+		if err := m.Advise(advice); err != nil {
+			t.Fatalf("could not advise %d: %+v", advice, err)
+		}
+	}
+	if err := m.Advise(mmap.AdviceDontNeed); err != nil {
+		t.Fatalf("could not advise: %+v", err)
+	}
+	if runtime.GOOS == "linux" && m.Bytes()[0] != 0 {
+		t.Fatalf("memory not released: %q", m.Bytes()[:5])
+	}
+
+	found := false
+	for _, info := range mmap.Mappings() {
+		if info.Kind == "anon" && info.Size == m.Len() {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("anonymous mapping not registered")
+	}
+}
+
+func TestAdviseFile(t *testing.T) {
+	f, err := mmap.Open("anon_test.go")
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	if err := f.Advise(mmap.AdviceRandom); err != nil {
+		t.Fatalf("could not advise: %+v", err)
+	}
+	if err := f.Advise(mmap.AdviceDontNeed); err != nil {
+		t.Fatalf("could not advise: %+v", err)
+	}
+	if got, want := f.Bytes()[:7], []byte("package"); !bytes.Equal(got, want) {
+		t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+	}
+	if err := f.Advise(mmap.Advice(42)); !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+}
@@ -0,0 +1,66 @@
+//go:build linux || darwin || freebsd
+
+package mmap
+
+import (
+	"context"
+	"os"
+	"runtime"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+func openAnon(size int, o *options) (*MapMem, error) {
+	start := now()
+	flags := syscall.MAP_ANON | syscall.MAP_PRIVATE
+	if o.huge {
+		hsize, err := hugePageSize(o.hugeSize)
+		if err != nil {
+			return nil, &MapError{Op: "MapMem.OpenAnon", Len: size, Err: err}
+		}
+		size = roundUp(size, hsize)
+		flags |= mapHugeFlags(hsize)
+	}
+	if o.populate {
+		flags |= mapPopulate
+	}
+
+	data, err := syscall.Mmap(-1, 0, size, PROT_READ|PROT_WRITE, flags)
+	if err != nil {
+		return nil, &MapError{Op: "MapMem.OpenAnon", Len: size, Err: os.NewSyscallError("mmap", err)}
+	}
+	if o.thp {
+		if err := adviseHugePages(data); err != nil {
+			o.log().Warn("MapMem.OpenAnon", "op", "OpenAnon", "size", size, "err", err)
+		}
+	}
+	if o.populate && mapPopulate == 0 {
+		_ = prefault(context.Background(), data, nil)
+	}
+
+	fd := &MapMem{
+		owner:    true,
+		writable: true,
+		anon:     true,
+		data:     data,
+		close:    dummyCloser,
+		unmap:    unmapAnon,
+		logger:   o.logger,
+	}
+	fd.reg = mappings.add(MappingInfo{
+		Kind:  "anon",
+		Size:  size,
+		Prot:  PROT_READ | PROT_WRITE,
+		Owner: true,
+	})
+	runtime.SetFinalizer(fd, finalizeMapMem)
+	fd.observe(EventOpen, start, 0, 0, nil)
+	return fd, nil
+}
+
+func unmapAnon(b []byte) error {
+	if err := syscall.Munmap(b); err != nil {
+		return os.NewSyscallError("munmap", err)
+	}
+	return nil
+}
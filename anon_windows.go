@@ -0,0 +1,60 @@
+//go:build windows
+
+package mmap
+
+import (
+	"context"
+	"os"
+	"runtime"
+
+	"github.com/godcong/mmap/unsafex"
+	syscall "golang.org/x/sys/windows"
+)
+
+func openAnon(size int, o *options) (*MapMem, error) {
+	start := now()
+	flags := uint32(syscall.MEM_RESERVE | syscall.MEM_COMMIT)
+	if o.huge {
+		hsize, err := hugePageSize(o.hugeSize)
+		if err != nil {
+			return nil, &MapError{Op: "MapMem.OpenAnon", Len: size, Err: err}
+		}
+		size = roundUp(size, hsize)
+		flags |= syscall.MEM_LARGE_PAGES
+	}
+
+	addr, err := syscall.VirtualAlloc(0, uintptr(size), flags, syscall.PAGE_READWRITE)
+	if err != nil {
+		return nil, &MapError{Op: "MapMem.OpenAnon", Len: size, Err: os.NewSyscallError("VirtualAlloc", err)}
+	}
+	data := unsafex.PtrToBytes(addr, size)
+	if o.populate {
+		_ = prefault(context.Background(), data, nil)
+	}
+
+	fd := &MapMem{
+		owner:    true,
+		writable: true,
+		anon:     true,
+		data:     data,
+		close:    dummyCloser,
+		unmap:    unmapAnon,
+		logger:   o.logger,
+	}
+	fd.reg = mappings.add(MappingInfo{
+		Kind:  "anon",
+		Size:  size,
+		Prot:  PROT_READ | PROT_WRITE,
+		Owner: true,
+	})
+	runtime.SetFinalizer(fd, finalizeMapMem)
+	fd.observe(EventOpen, start, 0, 0, nil)
+	return fd, nil
+}
+
+func unmapAnon(b []byte) error {
+	if err := syscall.VirtualFree(unsafex.BytesToPtr(b), 0, syscall.MEM_RELEASE); err != nil {
+		return os.NewSyscallError("VirtualFree", err)
+	}
+	return nil
+}
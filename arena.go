@@ -0,0 +1,291 @@
+package mmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	arenaMagic      = 0x52414d4d // "MMAR"
+	arenaVersion    = 1
+	arenaHeaderSize = 128
+	arenaBlockSize  = 16
+	arenaMinClass   = 32
+	arenaClasses    = 7 // 32 bytes .. 2 KiB blocks
+	arenaLarge      = 0xffffffff
+
+	arenaBlockUsed = 0x55534544 // "USED"
+	arenaBlockFree = 0x46524545 // "FREE"
+
+	// arenaLockCheck is the number of failed attempts to take the lock
+	// after which lock checks whether its holder is still running.
+	arenaLockCheck = 1 << 10
+
+	arenaLockOff  = 8
+	arenaSizeOff  = 16
+	arenaTopOff   = 24
+	arenaLargeOff = 32
+	arenaFreeOff  = 40
+)
+
+// Offset locates an allocation relative to the start of its mapping. Unlike
+// a pointer, an offset stays meaningful in every process that maps the same
+// segment, whatever address the mapping ends up at. The zero Offset never
+// refers to an allocation.
+type Offset uint64
+
+// Arena carves a mapping into variable-size allocations.
+//
+// Small requests are served from per size-class slabs of pageSize bytes,
+// larger ones are rounded up to whole pages. All allocator metadata lives in
+// the mapping itself, behind a 128 byte header, so every process attached
+// to the segment shares the same free lists. Metadata updates are guarded
+// by a spin lock stored in the header, which records the PID of its holder.
+// When a process dies while holding the lock, the next process waiting for
+// it takes it over; the metadata the dead process was changing may be left
+// inconsistent. Processes sharing an arena must see each other's PIDs, so
+// they must run in the same PID namespace.
+type Arena struct {
+	data []byte
+}
+
+// NewArena attaches an allocator to r, formatting the region first when it
+// does not carry an arena header yet. The region must be writable, as even
+// reads take the lock in the mapping; read-only regions return
+// ErrBadFileDesc.
+func NewArena(r Region) (*Arena, error) {
+	if !r.Writable() {
+		return nil, fmt.Errorf("Arena: %w", ErrBadFileDesc)
+	}
+	data := r.Bytes()
+	if len(data) < arenaHeaderSize+pageSize {
+		return nil, fmt.Errorf("Arena: region of %d bytes is too small: %w", len(data), ErrInvalid)
+	}
+	a := &Arena{data: data}
+	switch binary.LittleEndian.Uint32(data) {
+	case arenaMagic:
+		if v := binary.LittleEndian.Uint32(data[4:]); v != arenaVersion {
+			return nil, fmt.Errorf("Arena: unsupported version %d: %w", v, ErrInvalidFormat)
+		}
+		if size := a.get(arenaSizeOff); size > uint64(len(data)) {
+			return nil, fmt.Errorf("Arena: region shorter than arena (%d < %d): %w", len(data), size, ErrInvalidFormat)
+		}
+	case 0:
+		a.lock()
+		if binary.LittleEndian.Uint32(data) == 0 {
+			clear(data[arenaSizeOff:arenaHeaderSize])
+			a.set(arenaSizeOff, uint64(len(data)))
+			a.set(arenaTopOff, arenaHeaderSize)
+			binary.LittleEndian.PutUint32(data[4:], arenaVersion)
+			binary.LittleEndian.PutUint32(data, arenaMagic)
+		}
+		a.unlock()
+	default:
+		return nil, fmt.Errorf("Arena: %w", ErrInvalidFormat)
+	}
+	return a, nil
+}
+
+func (a *Arena) get(off int) uint64 {
+	return binary.LittleEndian.Uint64(a.data[off:])
+}
+
+func (a *Arena) set(off int, v uint64) {
+	binary.LittleEndian.PutUint64(a.data[off:], v)
+}
+
+func (a *Arena) lockWord() *uint32 {
+	return (*uint32)(unsafe.Pointer(&a.data[arenaLockOff]))
+}
+
+// lock takes the lock in the mapping, or takes it over from a process
+// that died holding it.
+func (a *Arena) lock() {
+	self := uint32(os.Getpid())
+	for i := 1; !atomic.CompareAndSwapUint32(a.lockWord(), 0, self); i++ {
+		if i%arenaLockCheck == 0 {
+			holder := atomic.LoadUint32(a.lockWord())
+			if holder != 0 && holder != self && !processAlive(int(holder)) &&
+				atomic.CompareAndSwapUint32(a.lockWord(), holder, self) {
+				Log().Warn("Arena.lock took over the lock of a dead process", "op", "lock", "pid", holder)
+				return
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+func (a *Arena) unlock() {
+	atomic.StoreUint32(a.lockWord(), 0)
+}
+
+// sizeClass returns the class serving a request of n bytes, or -1 when the
+// request needs a large block.
+func sizeClass(n int) int {
+	size := arenaMinClass
+	for c := 0; c < arenaClasses; c++ {
+		if n+arenaBlockSize <= size {
+			return c
+		}
+		size <<= 1
+	}
+	return -1
+}
+
+func classSize(c int) int {
+	return arenaMinClass << c
+}
+
+// Alloc reserves n bytes and returns their offset in the mapping.
+func (a *Arena) Alloc(n int) (Offset, error) {
+	if a == nil || n <= 0 {
+		return 0, ErrInvalid
+	}
+	a.lock()
+	defer a.unlock()
+
+	var (
+		block uint64
+		err   error
+	)
+	if c := sizeClass(n); c >= 0 {
+		block, err = a.allocSmall(c)
+	} else {
+		block, err = a.allocLarge(n + arenaBlockSize)
+	}
+	if err != nil {
+		return 0, err
+	}
+	binary.LittleEndian.PutUint32(a.data[block+12:], arenaBlockUsed)
+	return Offset(block + arenaBlockSize), nil
+}
+
+func (a *Arena) allocSmall(c int) (uint64, error) {
+	head := arenaFreeOff + c*8
+	if block := a.get(head); block != 0 {
+		a.set(head, a.get(int(block)+arenaBlockSize))
+		return block, nil
+	}
+
+	slab, err := a.bump(uint64(pageSize))
+	if err != nil {
+		return 0, err
+	}
+	size := uint64(classSize(c))
+	for b := slab; b+size <= slab+uint64(pageSize); b += size {
+		a.setBlock(b, size, uint32(c), arenaBlockFree)
+		if b != slab {
+			a.set(int(b)+arenaBlockSize, a.get(head))
+			a.set(head, b)
+		}
+	}
+	return slab, nil
+}
+
+func (a *Arena) allocLarge(n int) (uint64, error) {
+	size := uint64((n + pageSize - 1) / pageSize * pageSize)
+
+	prev := uint64(arenaLargeOff)
+	for block := a.get(arenaLargeOff); block != 0; {
+		bsize := a.get(int(block))
+		next := a.get(int(block) + arenaBlockSize)
+		if bsize >= size {
+			if rest := bsize - size; rest >= uint64(pageSize) {
+				tail := block + size
+				a.setBlock(tail, rest, arenaLarge, arenaBlockFree)
+				a.set(int(tail)+arenaBlockSize, next)
+				next = tail
+				a.setBlock(block, size, arenaLarge, arenaBlockFree)
+			}
+			a.set(int(prev), next)
+			return block, nil
+		}
+		prev, block = block+arenaBlockSize, next
+	}
+
+	block, err := a.bump(size)
+	if err != nil {
+		return 0, err
+	}
+	a.setBlock(block, size, arenaLarge, arenaBlockFree)
+	return block, nil
+}
+
+// bump takes size bytes from the unallocated tail of the arena.
+func (a *Arena) bump(size uint64) (uint64, error) {
+	top := a.get(arenaTopOff)
+	if top+size > a.get(arenaSizeOff) {
+		return 0, fmt.Errorf("Arena: allocating %d bytes: %w", size, ErrNoSpace)
+	}
+	a.set(arenaTopOff, top+size)
+	return top, nil
+}
+
+func (a *Arena) setBlock(block, size uint64, class, state uint32) {
+	b := a.data[block:]
+	binary.LittleEndian.PutUint64(b, size)
+	binary.LittleEndian.PutUint32(b[8:], class)
+	binary.LittleEndian.PutUint32(b[12:], state)
+}
+
+// block validates off and returns the offset of its block header.
+func (a *Arena) block(off Offset) (uint64, error) {
+	block := uint64(off) - arenaBlockSize
+	if off < arenaHeaderSize+arenaBlockSize || uint64(off) > a.get(arenaTopOff) ||
+		binary.LittleEndian.Uint32(a.data[block+12:]) != arenaBlockUsed {
+		return 0, fmt.Errorf("Arena: invalid offset %d: %w", off, ErrInvalid)
+	}
+	return block, nil
+}
+
+// Free releases the allocation at off.
+func (a *Arena) Free(off Offset) error {
+	if a == nil {
+		return ErrInvalid
+	}
+	a.lock()
+	defer a.unlock()
+
+	block, err := a.block(off)
+	if err != nil {
+		return err
+	}
+	head := arenaLargeOff
+	if c := binary.LittleEndian.Uint32(a.data[block+8:]); c != arenaLarge {
+		head = arenaFreeOff + int(c)*8
+	}
+	binary.LittleEndian.PutUint32(a.data[block+12:], arenaBlockFree)
+	a.set(int(block)+arenaBlockSize, a.get(head))
+	a.set(head, block)
+	return nil
+}
+
+// Size returns the usable size of the allocation at off, which may exceed
+// the size that was requested.
+func (a *Arena) Size(off Offset) int {
+	if a == nil {
+		return 0
+	}
+	a.lock()
+	defer a.unlock()
+
+	block, err := a.block(off)
+	if err != nil {
+		return 0
+	}
+	return int(a.get(int(block))) - arenaBlockSize
+}
+
+// Bytes returns the memory of the allocation at off, or nil when off is not
+// a live allocation. The slice aliases the mapping.
+func (a *Arena) Bytes(off Offset) []byte {
+	n := a.Size(off)
+	if n == 0 {
+		return nil
+	}
+	return a.data[off : int(off)+n : int(off)+n]
+}
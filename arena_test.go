@@ -0,0 +1,198 @@
+package mmap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/godcong/mmap"
+)
+
+func TestArena(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "arena.bin")
+	f, err := mmap.OpenFileS(fname, os.O_RDWR|os.O_CREATE, 0o644, 1<<20)
+	if err != nil {
+		t.Fatalf("could not mmap file: %+v", err)
+	}
+	defer f.Close()
+
+	a, err := mmap.NewArena(f)
+	if err != nil {
+		t.Fatalf("could not create arena: %+v", err)
+	}
+
+	sizes := []int{1, 15, 16, 17, 100, 1000, 2000, 5000, 20000}
+	offs := make([]mmap.Offset, len(sizes))
+	for i, n := range sizes {
+		off, err := a.Alloc(n)
+		if err != nil {
+			t.Fatalf("could not alloc %d: %+v", n, err)
+		}
+		if got := a.Size(off); got < n {
+			t.Fatalf("invalid size for %d: got=%d", n, got)
+		}
+		copy(a.Bytes(off), bytes.Repeat([]byte{byte(i + 1)}, n))
+		offs[i] = off
+	}
+
+	// A second mapping of the same file sees the allocations at the same
+	// offsets, although it lives at a different address.
+	g, err := mmap.OpenFile(fname, os.O_RDWR, 0o644)
+	if err != nil {
+		t.Fatalf("could not mmap file: %+v", err)
+	}
+	defer g.Close()
+	b, err := mmap.NewArena(g)
+	if err != nil {
+		t.Fatalf("could not attach arena: %+v", err)
+	}
+	for i, n := range sizes {
+		if got, want := b.Bytes(offs[i])[:n], bytes.Repeat([]byte{byte(i + 1)}, n); !bytes.Equal(got, want) {
+			t.Fatalf("invalid content for allocation %d", i)
+		}
+	}
+
+	for _, off := range offs {
+		if err := b.Free(off); err != nil {
+			t.Fatalf("could not free %d: %+v", off, err)
+		}
+	}
+	if err := a.Free(offs[0]); !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error on double free:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+
+	off, err := a.Alloc(sizes[0])
+	if err != nil {
+		t.Fatalf("could not alloc: %+v", err)
+	}
+	if got, want := off, offs[2]; got != want {
+		t.Fatalf("freed block not reused: got=%d, want=%d", got, want)
+	}
+	off, err = a.Alloc(sizes[len(sizes)-1])
+	if err != nil {
+		t.Fatalf("could not alloc: %+v", err)
+	}
+	if got, want := off, offs[len(offs)-1]; got != want {
+		t.Fatalf("freed large block not reused: got=%d, want=%d", got, want)
+	}
+}
+
+func TestArenaFull(t *testing.T) {
+	w, err := mmap.OpenMem(mmap.MapMemKeyInvalid, 4*os.Getpagesize())
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer w.Close()
+
+	a, err := mmap.NewArena(w)
+	if err != nil {
+		t.Fatalf("could not create arena: %+v", err)
+	}
+	for {
+		_, err = a.Alloc(1024)
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, mmap.ErrNoSpace) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrNoSpace)
+	}
+}
+
+func TestArenaReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "arena")
+	if err := os.WriteFile(path, make([]byte, 4*os.Getpagesize()), 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	if _, err := mmap.NewArena(f); !errors.Is(err, mmap.ErrBadFileDesc) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+	}
+}
+
+func TestArenaSharedMem(t *testing.T) {
+	w, err := mmap.OpenMem(mmap.MapMemKeyInvalid, 1<<16)
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer w.Close()
+	r, err := mmap.OpenMemS(w.ID())
+	if err != nil {
+		t.Fatalf("could not attach: %+v", err)
+	}
+	defer r.Close()
+
+	a, err := mmap.NewArena(w)
+	if err != nil {
+		t.Fatalf("could not create arena: %+v", err)
+	}
+	b, err := mmap.NewArena(r)
+	if err != nil {
+		t.Fatalf("could not attach arena: %+v", err)
+	}
+
+	off, err := b.Alloc(100)
+	if err != nil {
+		t.Fatalf("could not alloc: %+v", err)
+	}
+	copy(b.Bytes(off), "hello")
+	if got, want := a.Bytes(off)[:5], []byte("hello"); !bytes.Equal(got, want) {
+		t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+	}
+	if err := a.Free(off); err != nil {
+		t.Fatalf("could not free: %+v", err)
+	}
+	// The block freed through one handle is reused through the other.
+	again, err := b.Alloc(100)
+	if err != nil {
+		t.Fatalf("could not alloc: %+v", err)
+	}
+	if again != off {
+		t.Fatalf("freed block not reused: got=%d, want=%d", again, off)
+	}
+	if err := b.Free(again); err != nil {
+		t.Fatalf("could not free: %+v", err)
+	}
+}
+
+func TestArenaDeadHolder(t *testing.T) {
+	m, err := mmap.OpenAnon(1 << 16)
+	if err != nil {
+		t.Fatalf("could not map memory: %+v", err)
+	}
+	defer m.Close()
+	a, err := mmap.NewArena(m)
+	if err != nil {
+		t.Fatalf("could not create arena: %+v", err)
+	}
+
+	// Leave the lock to a process that has exited.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("could not run process: %+v", err)
+	}
+	binary.LittleEndian.PutUint32(m.Bytes()[8:], uint32(cmd.Process.Pid))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.Alloc(100)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("could not alloc: %+v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("lock of the dead process was not taken over")
+	}
+}
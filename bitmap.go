@@ -0,0 +1,85 @@
+package mmap
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Bitmap is a bit set stored in a mapping. All operations are atomic, so
+// processes sharing the mapping may update the same bitmap concurrently.
+type Bitmap struct {
+	words []uint64
+}
+
+// NewBitmap returns a bitmap over all whole 64-bit words of r. The bitmap
+// starts with whatever bits the mapping already holds. The region must be
+// writable; read-only regions return ErrBadFileDesc.
+func NewBitmap(r Region) (*Bitmap, error) {
+	if !r.Writable() {
+		return nil, fmt.Errorf("Bitmap: %w", ErrBadFileDesc)
+	}
+	return newBitmap(r.Bytes()), nil
+}
+
+func newBitmap(b []byte) *Bitmap {
+	n := len(b) / 8
+	if n == 0 {
+		return &Bitmap{}
+	}
+	return &Bitmap{words: unsafe.Slice((*uint64)(unsafe.Pointer(&b[0])), n)}
+}
+
+// Len returns the number of bits in the bitmap.
+func (b *Bitmap) Len() int {
+	return len(b.words) * 64
+}
+
+// Set sets bit i.
+func (b *Bitmap) Set(i int) {
+	atomic.OrUint64(&b.words[i/64], 1<<(i%64))
+}
+
+// Clear clears bit i.
+func (b *Bitmap) Clear(i int) {
+	atomic.AndUint64(&b.words[i/64], ^uint64(1<<(i%64)))
+}
+
+// Test reports whether bit i is set.
+func (b *Bitmap) Test(i int) bool {
+	return atomic.LoadUint64(&b.words[i/64])&(1<<(i%64)) != 0
+}
+
+// TestAndSet sets bit i and reports whether it was already set.
+func (b *Bitmap) TestAndSet(i int) bool {
+	mask := uint64(1 << (i % 64))
+	return atomic.OrUint64(&b.words[i/64], mask)&mask != 0
+}
+
+// Count returns the number of set bits.
+func (b *Bitmap) Count() int {
+	n := 0
+	for i := range b.words {
+		n += bits.OnesCount64(atomic.LoadUint64(&b.words[i]))
+	}
+	return n
+}
+
+// NextSet returns the index of the first set bit at or after i, or -1 when
+// there is none.
+func (b *Bitmap) NextSet(i int) int {
+	if i < 0 {
+		i = 0
+	}
+	for w := i / 64; w < len(b.words); w++ {
+		v := atomic.LoadUint64(&b.words[w])
+		if w == i/64 {
+			v &^= 1<<(i%64) - 1
+		}
+		if v != 0 {
+			return w*64 + bits.TrailingZeros64(v)
+		}
+	}
+	return -1
+}
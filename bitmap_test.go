@@ -0,0 +1,163 @@
+package mmap_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestBitmap(t *testing.T) {
+	w, err := mmap.OpenMem(mmap.MapMemKeyInvalid, 1024)
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer w.Close()
+
+	b, err := mmap.NewBitmap(w)
+	if err != nil {
+		t.Fatalf("could not create bitmap: %+v", err)
+	}
+	if got, want := b.Len(), 1024*8; got != want {
+		t.Fatalf("invalid len: got=%d, want=%d", got, want)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < b.Len(); i += 8 {
+				if i%3 == 0 {
+					b.Set(i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if got, want := b.Count(), (b.Len()+2)/3; got != want {
+		t.Fatalf("invalid count: got=%d, want=%d", got, want)
+	}
+	if !b.Test(3) || b.Test(4) {
+		t.Fatal("invalid test result")
+	}
+	if got, want := b.NextSet(4), 6; got != want {
+		t.Fatalf("invalid next set: got=%d, want=%d", got, want)
+	}
+	if b.TestAndSet(7) {
+		t.Fatal("bit 7 was reported set")
+	}
+	if !b.TestAndSet(7) {
+		t.Fatal("bit 7 was reported clear")
+	}
+	b.Clear(7)
+	b.Clear(6)
+	if got, want := b.NextSet(4), 9; got != want {
+		t.Fatalf("invalid next set: got=%d, want=%d", got, want)
+	}
+	if got, want := b.NextSet(b.Len()-1), -1; got != want {
+		t.Fatalf("invalid next set: got=%d, want=%d", got, want)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	w, err := mmap.OpenMem(mmap.MapMemKeyInvalid, 1<<16)
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer w.Close()
+
+	f, err := mmap.NewBloomFilter(w, 1000, 0.01, 42)
+	if err != nil {
+		t.Fatalf("could not create bloom filter: %+v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if added, err := f.Add([]byte(fmt.Sprintf("key-%d", i))); err != nil {
+			t.Fatalf("could not add key-%d: %+v", i, err)
+		} else if !added {
+			t.Logf("false positive on insert of key-%d", i)
+		}
+	}
+
+	r, err := mmap.OpenMemS(w.ID())
+	if err != nil {
+		t.Fatalf("could not open memory: %+v", err)
+	}
+	defer r.Close()
+
+	g, err := mmap.OpenBloomFilter(r)
+	if err != nil {
+		t.Fatalf("could not open bloom filter: %+v", err)
+	}
+	if g.K() != f.K() || g.M() != f.M() || g.Seed() != 42 {
+		t.Fatalf("invalid header: got=(%d,%d,%d), want=(%d,%d,%d)", g.K(), g.M(), g.Seed(), f.K(), f.M(), 42)
+	}
+	for i := 0; i < 1000; i++ {
+		if !g.Test([]byte(fmt.Sprintf("key-%d", i))) {
+			t.Fatalf("missing key-%d", i)
+		}
+	}
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if g.Test([]byte(fmt.Sprintf("other-%d", i))) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Fatalf("too many false positives: %d", fp)
+	}
+
+	// Keys added through the second handle show up in the first.
+	if added, err := g.Add([]byte("shared")); err != nil || !added {
+		t.Fatalf("could not add through second handle: %v, %+v", added, err)
+	}
+	if !f.Test([]byte("shared")) {
+		t.Fatal("missing key added through second handle")
+	}
+}
+
+func TestBloomFilterReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bloom")
+	if err := os.WriteFile(path, make([]byte, 1<<16), 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	w, err := mmap.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer w.Close()
+	f, err := mmap.NewBloomFilter(w, 1000, 0.01, 42)
+	if err != nil {
+		t.Fatalf("could not create bloom filter: %+v", err)
+	}
+	if _, err := f.Add([]byte("key")); err != nil {
+		t.Fatalf("could not add: %+v", err)
+	}
+
+	r, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer r.Close()
+	if _, err := mmap.NewBitmap(r); !errors.Is(err, mmap.ErrBadFileDesc) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+	}
+	if _, err := mmap.NewBloomFilter(r, 1000, 0.01, 42); !errors.Is(err, mmap.ErrBadFileDesc) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+	}
+	g, err := mmap.OpenBloomFilter(r)
+	if err != nil {
+		t.Fatalf("could not open bloom filter: %+v", err)
+	}
+	if !g.Test([]byte("key")) {
+		t.Fatal("missing key")
+	}
+	if _, err := g.Add([]byte("other")); !errors.Is(err, mmap.ErrBadFileDesc) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+	}
+}
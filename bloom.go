@@ -0,0 +1,131 @@
+package mmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	bloomMagic      = 0x46424d4d // "MMBF"
+	bloomVersion    = 1
+	bloomHeaderSize = 64
+)
+
+// BloomFilter is a Bloom filter stored in a mapping.
+//
+// The mapping starts with a 64 byte header recording the number of hash
+// functions k, the number of bits m and the hash seed, followed by the bit
+// array. Any process can reopen the filter from the mapping alone with
+// OpenBloomFilter.
+type BloomFilter struct {
+	bits     *Bitmap
+	k        int
+	m        uint64
+	seed     uint64
+	writable bool
+}
+
+// NewBloomFilter formats r as a Bloom filter sized for n keys at a false
+// positive rate of p. The region must be writable; read-only regions return
+// ErrBadFileDesc.
+func NewBloomFilter(r Region, n int, p float64, seed uint64) (*BloomFilter, error) {
+	if n <= 0 || p <= 0 || p >= 1 {
+		return nil, ErrInvalid
+	}
+	if !r.Writable() {
+		return nil, fmt.Errorf("BloomFilter: %w", ErrBadFileDesc)
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) &^ 63
+	k := max(int(math.Round(float64(m)/float64(n)*math.Ln2)), 1)
+
+	data := r.Bytes()
+	if need := bloomHeaderSize + int(m/8); len(data) < need {
+		return nil, fmt.Errorf("BloomFilter: need %d bytes, region has %d: %w", need, len(data), ErrNoSpace)
+	}
+	clear(data[:bloomHeaderSize+int(m/8)])
+	binary.LittleEndian.PutUint32(data[4:], bloomVersion)
+	binary.LittleEndian.PutUint32(data[8:], uint32(k))
+	binary.LittleEndian.PutUint64(data[16:], m)
+	binary.LittleEndian.PutUint64(data[24:], seed)
+	binary.LittleEndian.PutUint32(data[0:], bloomMagic)
+	return openBloomFilter(data, true)
+}
+
+// OpenBloomFilter attaches to a Bloom filter previously created in r by
+// NewBloomFilter, possibly by another process. When r is read-only, the
+// filter can only be tested and Add returns ErrBadFileDesc.
+func OpenBloomFilter(r Region) (*BloomFilter, error) {
+	return openBloomFilter(r.Bytes(), r.Writable())
+}
+
+func openBloomFilter(data []byte, writable bool) (*BloomFilter, error) {
+	if len(data) < bloomHeaderSize || binary.LittleEndian.Uint32(data) != bloomMagic {
+		return nil, fmt.Errorf("BloomFilter: %w", ErrInvalidFormat)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != bloomVersion {
+		return nil, fmt.Errorf("BloomFilter: unsupported version %d: %w", v, ErrInvalidFormat)
+	}
+	f := &BloomFilter{
+		k:        int(binary.LittleEndian.Uint32(data[8:])),
+		m:        binary.LittleEndian.Uint64(data[16:]),
+		seed:     binary.LittleEndian.Uint64(data[24:]),
+		writable: writable,
+	}
+	if f.k == 0 || f.m == 0 || f.m%64 != 0 || uint64(len(data)-bloomHeaderSize) < f.m/8 {
+		return nil, fmt.Errorf("BloomFilter: corrupt header: %w", ErrInvalidFormat)
+	}
+	f.bits = newBitmap(data[bloomHeaderSize : bloomHeaderSize+f.m/8])
+	return f, nil
+}
+
+// K returns the number of hash functions.
+func (f *BloomFilter) K() int { return f.k }
+
+// M returns the number of bits.
+func (f *BloomFilter) M() uint64 { return f.m }
+
+// Seed returns the hash seed.
+func (f *BloomFilter) Seed() uint64 { return f.seed }
+
+// hashes returns the two base hashes combined into the k bit positions.
+func (f *BloomFilter) hashes(key []byte) (uint64, uint64) {
+	h := f.seed ^ 14695981039346656037
+	for _, c := range key {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	// splitmix64 finaliser for the second, independent-looking hash.
+	g := h + 0x9e3779b97f4a7c15
+	g = (g ^ (g >> 30)) * 0xbf58476d1ce4e5b9
+	g = (g ^ (g >> 27)) * 0x94d049bb133111eb
+	return h, (g ^ (g >> 31)) | 1
+}
+
+// Add inserts key and reports whether it was new, that is whether the
+// filter did not already contain it.
+func (f *BloomFilter) Add(key []byte) (bool, error) {
+	if !f.writable {
+		return false, fmt.Errorf("BloomFilter: %w", ErrBadFileDesc)
+	}
+	h1, h2 := f.hashes(key)
+	added := false
+	for i := 0; i < f.k; i++ {
+		if !f.bits.TestAndSet(int((h1 + uint64(i)*h2) % f.m)) {
+			added = true
+		}
+	}
+	return added, nil
+}
+
+// Test reports whether key may have been added to the filter.
+func (f *BloomFilter) Test(key []byte) bool {
+	h1, h2 := f.hashes(key)
+	for i := 0; i < f.k; i++ {
+		if !f.bits.Test(int((h1 + uint64(i)*h2) % f.m)) {
+			return false
+		}
+	}
+	return true
+}
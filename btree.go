@@ -0,0 +1,958 @@
+package mmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	btreeMagic      = 0x54424d4d // "MMBT"
+	btreeVersion    = 1
+	btreePageHeader = 16
+	btreeElemSize   = 8
+
+	btreeFlagLeaf     = 0x01
+	btreeFlagBranch   = 0x02
+	btreeFlagFreelist = 0x04
+	btreeFlagMeta     = 0x08
+
+	// btreeMetaFreelist marks the freelist recorded in the meta page as
+	// complete, even when it is empty.
+	btreeMetaFreelist = 0x01
+)
+
+// BTree is a page-oriented B+tree stored in a memory-mapped file.
+//
+// Pages are pageSize bytes long. Pages 0 and 1 hold alternating meta
+// records, the remaining pages hold tree nodes. Writers never modify a page
+// that is reachable from a committed root: every Put or Delete copies the
+// path it touches into fresh pages and publishes a new root. Readers work on
+// the snapshot that was current when they started and never wait for the
+// writer. Pages released by a writer are recycled through a freelist once no
+// reader can see them anymore.
+type BTree struct {
+	path     string
+	writable bool
+
+	wmu sync.Mutex // serialises writers
+
+	mu      sync.Mutex // guards the fields below
+	cur     *btreeMap
+	meta    btreeMeta
+	readers map[uint64]int
+	pending map[uint64][]uint64
+	free    []uint64
+	closed  bool
+}
+
+type btreeMeta struct {
+	flags    uint32
+	root     uint64
+	freelist uint64
+	pages    uint64
+	txid     uint64
+}
+
+// btreeMap is a reference counted mapping of the tree file. The tree
+// replaces its mapping when the file grows; older mappings stay alive until
+// the last reader using them is done.
+type btreeMap struct {
+	file *MapFile
+	refs int
+}
+
+// OpenBTree opens the B+tree stored in the named file. With os.O_CREATE a
+// missing or empty file is initialised as an empty tree.
+func OpenBTree(path string, flag int) (*BTree, error) {
+	fresh := false
+	if fi, err := os.Stat(path); err != nil {
+		if !os.IsNotExist(err) || flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		fresh = true
+	} else {
+		fresh = fi.Size() == 0
+	}
+
+	size := 0
+	if fresh {
+		size = 4 * pageSize
+	}
+	f, err := OpenFileS(path, flag, 0o644, size)
+	if err != nil {
+		return nil, err
+	}
+	t := &BTree{
+		path:     path,
+		writable: f.Writable(),
+		cur:      &btreeMap{file: f, refs: 1},
+		readers:  make(map[uint64]int),
+		pending:  make(map[uint64][]uint64),
+	}
+
+	switch {
+	case fresh && !t.writable:
+		err = fmt.Errorf("BTree: %q: empty file: %w", path, ErrInvalidFormat)
+	case fresh:
+		err = t.init()
+	default:
+		err = t.load()
+	}
+	if err == nil && t.writable {
+		err = t.loadFreelist()
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *BTree) init() error {
+	data := t.cur.file.data
+	clear(data[:3*pageSize])
+	binary.LittleEndian.PutUint16(data[2*pageSize:], btreeFlagLeaf)
+	t.meta = btreeMeta{flags: btreeMetaFreelist, root: 2, pages: 3}
+	writeBTreeMeta(t.page(0), t.meta)
+	t.meta.txid++
+	writeBTreeMeta(t.page(1), t.meta)
+	return nil
+}
+
+func (t *BTree) load() error {
+	var (
+		meta  btreeMeta
+		found bool
+	)
+	for id := uint64(0); id < 2; id++ {
+		if (id+1)*uint64(pageSize) > uint64(len(t.cur.file.data)) {
+			break
+		}
+		m, ok := readBTreeMeta(t.page(id))
+		if ok && (!found || m.txid > meta.txid) {
+			meta, found = m, true
+		}
+	}
+	if !found || meta.pages*uint64(pageSize) > uint64(len(t.cur.file.data)) {
+		return fmt.Errorf("BTree: %q: no valid meta page: %w", t.path, ErrInvalidFormat)
+	}
+	t.meta = meta
+	return nil
+}
+
+// loadFreelist reads the freelist recorded by the last clean Close, or
+// rebuilds it from the pages reachable from the root. The recorded freelist
+// is invalidated immediately, so a crash never leaves a stale one behind.
+func (t *BTree) loadFreelist() error {
+	if t.meta.flags&btreeMetaFreelist == 0 {
+		t.rebuildFreelist()
+	} else {
+		for id := t.meta.freelist; id != 0; {
+			p := btreePage(t.page(id))
+			if id >= t.meta.pages || p.flags() != btreeFlagFreelist {
+				t.free = t.free[:0]
+				t.rebuildFreelist()
+				break
+			}
+			for i := 0; i < p.count(); i++ {
+				t.free = append(t.free, binary.LittleEndian.Uint64(p[btreePageHeader+i*8:]))
+			}
+			t.free = append(t.free, id)
+			id = binary.LittleEndian.Uint64(p[8:])
+		}
+	}
+
+	t.meta.flags &^= btreeMetaFreelist
+	t.meta.freelist = 0
+	t.meta.txid++
+	writeBTreeMeta(t.page(t.meta.txid%2), t.meta)
+	return nil
+}
+
+func (t *BTree) rebuildFreelist() {
+	used := make([]bool, t.meta.pages)
+	var walk func(id uint64)
+	walk = func(id uint64) {
+		used[id] = true
+		p := btreePage(t.page(id))
+		if p.flags() != btreeFlagBranch {
+			return
+		}
+		for i := 0; i < p.count(); i++ {
+			walk(p.child(i))
+		}
+	}
+	walk(t.meta.root)
+	for id := uint64(2); id < t.meta.pages; id++ {
+		if !used[id] {
+			t.free = append(t.free, id)
+		}
+	}
+	if DebugLogEnabled() {
+		Log().Debug("BTree.rebuildFreelist", "path", t.path, "pages", t.meta.pages, "free", len(t.free))
+	}
+}
+
+func (t *BTree) page(id uint64) []byte {
+	return mapPage(t.cur.file, id)
+}
+
+func mapPage(f *MapFile, id uint64) []byte {
+	off := int(id) * pageSize
+	return f.data[off : off+pageSize : off+pageSize]
+}
+
+func writeBTreeMeta(p []byte, m btreeMeta) {
+	clear(p[:btreePageHeader+56])
+	binary.LittleEndian.PutUint16(p[0:], btreeFlagMeta)
+	binary.LittleEndian.PutUint32(p[16:], btreeMagic)
+	binary.LittleEndian.PutUint32(p[20:], btreeVersion)
+	binary.LittleEndian.PutUint32(p[24:], uint32(pageSize))
+	binary.LittleEndian.PutUint32(p[28:], m.flags)
+	binary.LittleEndian.PutUint64(p[32:], m.root)
+	binary.LittleEndian.PutUint64(p[40:], m.freelist)
+	binary.LittleEndian.PutUint64(p[48:], m.pages)
+	binary.LittleEndian.PutUint64(p[56:], m.txid)
+	binary.LittleEndian.PutUint64(p[64:], fnv64a(p[16:64]))
+}
+
+func readBTreeMeta(p []byte) (btreeMeta, bool) {
+	if binary.LittleEndian.Uint16(p[0:]) != btreeFlagMeta ||
+		binary.LittleEndian.Uint32(p[16:]) != btreeMagic ||
+		binary.LittleEndian.Uint32(p[20:]) != btreeVersion ||
+		binary.LittleEndian.Uint32(p[24:]) != uint32(pageSize) ||
+		binary.LittleEndian.Uint64(p[64:]) != fnv64a(p[16:64]) {
+		return btreeMeta{}, false
+	}
+	return btreeMeta{
+		flags:    binary.LittleEndian.Uint32(p[28:]),
+		root:     binary.LittleEndian.Uint64(p[32:]),
+		freelist: binary.LittleEndian.Uint64(p[40:]),
+		pages:    binary.LittleEndian.Uint64(p[48:]),
+		txid:     binary.LittleEndian.Uint64(p[56:]),
+	}, true
+}
+
+// Get returns a copy of the value stored for key.
+func (t *BTree) Get(key []byte) ([]byte, bool) {
+	c := t.Cursor()
+	defer c.Close()
+
+	k, v := c.Seek(key)
+	if k == nil || !bytes.Equal(k, key) {
+		return nil, false
+	}
+	return bytes.Clone(v), true
+}
+
+// Put stores value under key. Keys must not be empty, and a key and its
+// value together must fit in a quarter of a page.
+func (t *BTree) Put(key, value []byte) error {
+	if t == nil {
+		return ErrInvalid
+	}
+	if len(key) == 0 || len(key) > math.MaxUint16 ||
+		btreeElemSize+len(key)+len(value) > (pageSize-btreePageHeader)/4 {
+		return fmt.Errorf("BTree: invalid entry size %d/%d: %w", len(key), len(value), ErrInvalid)
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return t.update(func(tx *btreeTx) ([]btreeRef, bool, error) {
+		refs, err := tx.put(tx.meta.root, key, value)
+		return refs, true, err
+	})
+}
+
+// Delete removes key from the tree and reports whether it was present.
+func (t *BTree) Delete(key []byte) (bool, error) {
+	if t == nil {
+		return false, ErrInvalid
+	}
+	found := false
+	err := t.update(func(tx *btreeTx) ([]btreeRef, bool, error) {
+		refs, ok, err := tx.delete(tx.meta.root, key)
+		found = ok
+		return refs, ok, err
+	})
+	return found, err
+}
+
+func (t *BTree) update(fn func(tx *btreeTx) ([]btreeRef, bool, error)) error {
+	if !t.writable {
+		return ErrBadFileDesc
+	}
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	t.mu.Lock()
+	closed := t.closed
+	tx := &btreeTx{t: t, meta: t.meta, allocated: make(map[uint64]bool)}
+	t.mu.Unlock()
+	if closed {
+		return fmt.Errorf("BTree: %w", ErrClosed)
+	}
+	tx.meta.txid++
+
+	refs, changed, err := fn(tx)
+	if err == nil && changed {
+		err = tx.setRoot(refs)
+	}
+	if err != nil || !changed {
+		tx.rollback()
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+// Sync commits the tree to stable storage.
+func (t *BTree) Sync() error {
+	if t == nil {
+		return ErrInvalid
+	}
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	return t.cur.file.Sync()
+}
+
+// Close records the freelist, syncs and unmaps the tree. Cursors that are
+// still open keep their mapping alive until they are closed.
+func (t *BTree) Close() error {
+	if t == nil {
+		return ErrInvalid
+	}
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	var err error
+	if t.writable {
+		err = t.saveFreelist()
+		if serr := t.cur.file.Sync(); err == nil {
+			err = serr
+		}
+	}
+	t.unref(t.cur)
+	return err
+}
+
+// saveFreelist stores all recyclable pages in a chain of freelist pages.
+// Open cursors may still read the pages of pending transactions, so the
+// chain is stored in free pages, or in new pages at the end of the file.
+func (t *BTree) saveFreelist() error {
+	free := t.free
+	var pending []uint64
+	for _, p := range t.pending {
+		pending = append(pending, p...)
+	}
+	t.free, t.pending = nil, nil
+
+	per := (pageSize - btreePageHeader) / 8
+	pages := t.meta.pages
+	var store []uint64
+	for len(store)*per < len(free)+len(pending) {
+		if n := len(free); n > 0 {
+			store = append(store, free[n-1])
+			free = free[:n-1]
+		} else {
+			store = append(store, pages)
+			pages++
+		}
+	}
+	if uint64(len(t.cur.file.data)/pageSize) < pages {
+		// Without a recorded freelist the next open rebuilds it.
+		f, err := t.remap(pages)
+		if err != nil {
+			return err
+		}
+		old := t.cur
+		t.cur = &btreeMap{file: f, refs: 1}
+		t.unref(old)
+	}
+	t.meta.pages = pages
+	ids := append(free, pending...)
+
+	next := uint64(0)
+	for i, id := range store {
+		chunk := ids[i*per : min((i+1)*per, len(ids))]
+		p := t.page(id)
+		clear(p[:btreePageHeader])
+		binary.LittleEndian.PutUint16(p[0:], btreeFlagFreelist)
+		binary.LittleEndian.PutUint16(p[2:], uint16(len(chunk)))
+		binary.LittleEndian.PutUint64(p[8:], next)
+		for j, free := range chunk {
+			binary.LittleEndian.PutUint64(p[btreePageHeader+j*8:], free)
+		}
+		next = id
+	}
+
+	t.meta.flags |= btreeMetaFreelist
+	t.meta.freelist = next
+	t.meta.txid++
+	writeBTreeMeta(t.page(t.meta.txid%2), t.meta)
+	return nil
+}
+
+// snapshot pins the current root and mapping for a reader.
+func (t *BTree) snapshot() (*btreeMap, btreeMeta, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, btreeMeta{}, false
+	}
+	t.cur.refs++
+	t.readers[t.meta.txid]++
+	return t.cur, t.meta, true
+}
+
+func (t *BTree) releaseSnapshot(m *btreeMap, meta btreeMeta) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.readers[meta.txid]--; t.readers[meta.txid] == 0 {
+		delete(t.readers, meta.txid)
+	}
+	t.reclaim()
+	t.unref(m)
+}
+
+// reclaim moves pages freed by a transaction to the freelist once every
+// active reader started after that transaction.
+func (t *BTree) reclaim() {
+	oldest := uint64(math.MaxUint64)
+	for txid := range t.readers {
+		oldest = min(oldest, txid)
+	}
+	for txid, ids := range t.pending {
+		if txid <= oldest {
+			t.free = append(t.free, ids...)
+			delete(t.pending, txid)
+		}
+	}
+}
+
+func (t *BTree) unref(m *btreeMap) {
+	if m.refs--; m.refs == 0 {
+		_ = m.file.Close()
+	}
+}
+
+// grow remaps the tree file so that it holds at least pages pages.
+func (t *BTree) grow(pages uint64) error {
+	f, err := t.remap(pages)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := t.cur
+	t.cur = &btreeMap{file: f, refs: 1}
+	t.unref(old)
+	return nil
+}
+
+// remap extends the tree file to hold at least pages pages and maps it
+// again. The caller installs the new mapping.
+func (t *BTree) remap(pages uint64) (*MapFile, error) {
+	size := len(t.cur.file.data)
+	for uint64(size/pageSize) < pages {
+		size *= 2
+	}
+	f, err := OpenFileS(t.path, os.O_RDWR, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if DebugLogEnabled() {
+		Log().Debug("BTree.grow", "path", t.path, "size", size)
+	}
+	return f, nil
+}
+
+// btreeRef points at a written node together with its smallest key.
+type btreeRef struct {
+	key []byte
+	id  uint64
+}
+
+// btreeTx is a single copy-on-write update of the tree.
+type btreeTx struct {
+	t         *BTree
+	meta      btreeMeta
+	allocated map[uint64]bool
+	freed     []uint64
+}
+
+func (tx *btreeTx) alloc() (uint64, error) {
+	t := tx.t
+	t.mu.Lock()
+	if n := len(t.free); n > 0 {
+		id := t.free[n-1]
+		t.free = t.free[:n-1]
+		t.mu.Unlock()
+		tx.allocated[id] = true
+		return id, nil
+	}
+	t.mu.Unlock()
+
+	id := tx.meta.pages
+	if uint64(len(t.cur.file.data)/pageSize) <= id {
+		if err := t.grow(id + 1); err != nil {
+			return 0, err
+		}
+	}
+	tx.meta.pages++
+	tx.allocated[id] = true
+	return id, nil
+}
+
+// release drops a page from the tree. Pages written by this transaction are
+// invisible to readers and can be reused at once.
+func (tx *btreeTx) release(id uint64) {
+	if tx.allocated[id] {
+		delete(tx.allocated, id)
+		tx.t.mu.Lock()
+		tx.t.free = append(tx.t.free, id)
+		tx.t.mu.Unlock()
+		return
+	}
+	tx.freed = append(tx.freed, id)
+}
+
+func (tx *btreeTx) node(id uint64) *btreeNode {
+	return readBTreeNode(tx.t.page(id))
+}
+
+// write stores n in as many new pages as it needs.
+func (tx *btreeTx) write(n *btreeNode) ([]btreeRef, error) {
+	var refs []btreeRef
+	for _, c := range n.split() {
+		id, err := tx.alloc()
+		if err != nil {
+			return nil, err
+		}
+		c.writeTo(tx.t.page(id))
+		var key []byte
+		if len(c.keys) > 0 {
+			key = c.keys[0]
+		}
+		refs = append(refs, btreeRef{key: key, id: id})
+	}
+	return refs, nil
+}
+
+func (tx *btreeTx) put(id uint64, key, value []byte) ([]btreeRef, error) {
+	n := tx.node(id)
+	if n.leaf {
+		i, found := n.search(key)
+		if found {
+			n.vals[i] = value
+		} else {
+			n.keys = insertAt(n.keys, i, key)
+			n.vals = insertAt(n.vals, i, value)
+		}
+	} else {
+		i := n.childIndex(key)
+		refs, err := tx.put(n.kids[i], key, value)
+		if err != nil {
+			return nil, err
+		}
+		n.splice(i, 1, refs)
+	}
+	tx.release(id)
+	return tx.write(n)
+}
+
+func (tx *btreeTx) delete(id uint64, key []byte) ([]btreeRef, bool, error) {
+	n := tx.node(id)
+	if n.leaf {
+		i, found := n.search(key)
+		if !found {
+			return nil, false, nil
+		}
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		n.vals = append(n.vals[:i], n.vals[i+1:]...)
+	} else {
+		i := n.childIndex(key)
+		refs, ok, err := tx.delete(n.kids[i], key)
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+		n.splice(i, 1, refs)
+		if len(refs) == 1 {
+			if err := tx.rebalance(n, i); err != nil {
+				return nil, true, err
+			}
+		}
+	}
+	tx.release(id)
+	if len(n.keys) == 0 {
+		return nil, true, nil
+	}
+	refs, err := tx.write(n)
+	return refs, true, err
+}
+
+// rebalance merges the child at index i of n with a sibling when the child
+// has become less than a quarter full.
+func (tx *btreeTx) rebalance(n *btreeNode, i int) error {
+	if len(n.kids) < 2 || tx.node(n.kids[i]).size() >= pageSize/4 {
+		return nil
+	}
+	lo := i
+	if i+1 == len(n.kids) {
+		lo = i - 1
+	}
+	left, right := tx.node(n.kids[lo]), tx.node(n.kids[lo+1])
+	left.keys = append(left.keys, right.keys...)
+	left.vals = append(left.vals, right.vals...)
+	left.kids = append(left.kids, right.kids...)
+	tx.release(n.kids[lo])
+	tx.release(n.kids[lo+1])
+
+	refs, err := tx.write(left)
+	if err != nil {
+		return err
+	}
+	n.splice(lo, 2, refs)
+	return nil
+}
+
+// setRoot installs the nodes produced by an update as the new root, adding
+// branch levels on overflow and collapsing single-child branches.
+func (tx *btreeTx) setRoot(refs []btreeRef) error {
+	var err error
+	for len(refs) > 1 {
+		n := &btreeNode{}
+		n.splice(0, 0, refs)
+		if refs, err = tx.write(n); err != nil {
+			return err
+		}
+	}
+	if len(refs) == 0 {
+		if refs, err = tx.write(&btreeNode{leaf: true}); err != nil {
+			return err
+		}
+	}
+
+	root := refs[0].id
+	for {
+		p := btreePage(tx.t.page(root))
+		if p.flags() != btreeFlagBranch || p.count() != 1 {
+			break
+		}
+		tx.release(root)
+		root = p.child(0)
+	}
+	tx.meta.root = root
+	return nil
+}
+
+func (tx *btreeTx) commit() {
+	t := tx.t
+	writeBTreeMeta(t.page(tx.meta.txid%2), tx.meta)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.meta = tx.meta
+	if len(tx.freed) > 0 {
+		t.pending[tx.meta.txid] = tx.freed
+	}
+	t.reclaim()
+}
+
+func (tx *btreeTx) rollback() {
+	t := tx.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range tx.allocated {
+		if id < t.meta.pages {
+			t.free = append(t.free, id)
+		}
+	}
+}
+
+// btreePage gives zero-copy access to an encoded node.
+//
+// A page starts with a 16 byte header: flags (uint16), element count
+// (uint16), 4 reserved bytes and the next page of a freelist chain. It is
+// followed by one 8 byte element per entry holding the entry offset
+// (uint32), key length (uint16) and value length (uint16). Branch values are
+// the 8 byte child page ids.
+type btreePage []byte
+
+func (p btreePage) flags() uint16 { return binary.LittleEndian.Uint16(p[0:]) }
+func (p btreePage) count() int    { return int(binary.LittleEndian.Uint16(p[2:])) }
+
+func (p btreePage) elem(i int) (off, klen, vlen int) {
+	e := p[btreePageHeader+i*btreeElemSize:]
+	return int(binary.LittleEndian.Uint32(e)),
+		int(binary.LittleEndian.Uint16(e[4:])),
+		int(binary.LittleEndian.Uint16(e[6:]))
+}
+
+func (p btreePage) key(i int) []byte {
+	off, klen, _ := p.elem(i)
+	return p[off : off+klen : off+klen]
+}
+
+func (p btreePage) value(i int) []byte {
+	off, klen, vlen := p.elem(i)
+	return p[off+klen : off+klen+vlen : off+klen+vlen]
+}
+
+func (p btreePage) child(i int) uint64 {
+	return binary.LittleEndian.Uint64(p.value(i))
+}
+
+// search returns the index of the first key >= key.
+func (p btreePage) search(key []byte) int {
+	return sort.Search(p.count(), func(i int) bool {
+		return bytes.Compare(p.key(i), key) >= 0
+	})
+}
+
+// childIndex returns the index of the child that may hold key.
+func (p btreePage) childIndex(key []byte) int {
+	i := sort.Search(p.count(), func(i int) bool {
+		return bytes.Compare(p.key(i), key) > 0
+	})
+	return max(i-1, 0)
+}
+
+// btreeNode is a decoded, modifiable copy of a page.
+type btreeNode struct {
+	leaf bool
+	keys [][]byte
+	vals [][]byte
+	kids []uint64
+}
+
+func readBTreeNode(b []byte) *btreeNode {
+	p := btreePage(b)
+	n := &btreeNode{leaf: p.flags() == btreeFlagLeaf}
+	for i := 0; i < p.count(); i++ {
+		n.keys = append(n.keys, bytes.Clone(p.key(i)))
+		if n.leaf {
+			n.vals = append(n.vals, bytes.Clone(p.value(i)))
+		} else {
+			n.kids = append(n.kids, p.child(i))
+		}
+	}
+	return n
+}
+
+func (n *btreeNode) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) >= 0
+	})
+	return i, i < len(n.keys) && bytes.Equal(n.keys[i], key)
+}
+
+func (n *btreeNode) childIndex(key []byte) int {
+	i := sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) > 0
+	})
+	return max(i-1, 0)
+}
+
+// splice replaces cnt children starting at i with refs.
+func (n *btreeNode) splice(i, cnt int, refs []btreeRef) {
+	keys := make([][]byte, 0, len(n.keys)-cnt+len(refs))
+	kids := make([]uint64, 0, cap(keys))
+	keys = append(keys, n.keys[:i]...)
+	kids = append(kids, n.kids[:i]...)
+	for _, r := range refs {
+		keys = append(keys, r.key)
+		kids = append(kids, r.id)
+	}
+	n.keys = append(keys, n.keys[i+cnt:]...)
+	n.kids = append(kids, n.kids[i+cnt:]...)
+}
+
+func (n *btreeNode) entrySize(i int) int {
+	if n.leaf {
+		return btreeElemSize + len(n.keys[i]) + len(n.vals[i])
+	}
+	return btreeElemSize + len(n.keys[i]) + 8
+}
+
+func (n *btreeNode) size() int {
+	sz := btreePageHeader
+	for i := range n.keys {
+		sz += n.entrySize(i)
+	}
+	return sz
+}
+
+// split divides n into nodes of roughly equal size that each fit a page.
+func (n *btreeNode) split() []*btreeNode {
+	size := n.size()
+	if size <= pageSize {
+		return []*btreeNode{n}
+	}
+	target := size / ((size + pageSize - 1) / pageSize)
+
+	var (
+		nodes []*btreeNode
+		cur   = &btreeNode{leaf: n.leaf}
+		sz    = btreePageHeader
+	)
+	for i := range n.keys {
+		es := n.entrySize(i)
+		if len(cur.keys) > 0 && (sz+es > pageSize || sz >= target) {
+			nodes = append(nodes, cur)
+			cur, sz = &btreeNode{leaf: n.leaf}, btreePageHeader
+		}
+		cur.keys = append(cur.keys, n.keys[i])
+		if n.leaf {
+			cur.vals = append(cur.vals, n.vals[i])
+		} else {
+			cur.kids = append(cur.kids, n.kids[i])
+		}
+		sz += es
+	}
+	return append(nodes, cur)
+}
+
+func (n *btreeNode) writeTo(b []byte) {
+	clear(b[:btreePageHeader])
+	flags := uint16(btreeFlagBranch)
+	if n.leaf {
+		flags = btreeFlagLeaf
+	}
+	binary.LittleEndian.PutUint16(b[0:], flags)
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(n.keys)))
+
+	off := btreePageHeader + len(n.keys)*btreeElemSize
+	for i, k := range n.keys {
+		e := b[btreePageHeader+i*btreeElemSize:]
+		binary.LittleEndian.PutUint32(e, uint32(off))
+		binary.LittleEndian.PutUint16(e[4:], uint16(len(k)))
+		off += copy(b[off:], k)
+		if n.leaf {
+			binary.LittleEndian.PutUint16(e[6:], uint16(len(n.vals[i])))
+			off += copy(b[off:], n.vals[i])
+		} else {
+			binary.LittleEndian.PutUint16(e[6:], 8)
+			binary.LittleEndian.PutUint64(b[off:], n.kids[i])
+			off += 8
+		}
+	}
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+// Cursor iterates over the keys of a BTree in order. A cursor reads a
+// consistent snapshot of the tree taken when it was created; the slices it
+// returns point into the mapping and stay valid until Close.
+type Cursor struct {
+	t     *BTree
+	m     *btreeMap
+	meta  btreeMeta
+	stack []cursorFrame
+}
+
+type cursorFrame struct {
+	page btreePage
+	idx  int
+}
+
+// Cursor returns a cursor over the current snapshot of the tree.
+// The cursor must be closed to release the snapshot.
+func (t *BTree) Cursor() *Cursor {
+	c := &Cursor{t: t}
+	if t == nil {
+		return c
+	}
+	if m, meta, ok := t.snapshot(); ok {
+		c.m, c.meta = m, meta
+	}
+	return c
+}
+
+// First moves the cursor to the first key.
+func (c *Cursor) First() (key, value []byte) {
+	return c.Seek(nil)
+}
+
+// Seek moves the cursor to the first key that is >= key. It returns nil
+// when no such key exists.
+func (c *Cursor) Seek(key []byte) ([]byte, []byte) {
+	if c.m == nil {
+		return nil, nil
+	}
+	c.stack = c.stack[:0]
+	id := c.meta.root
+	for {
+		p := btreePage(mapPage(c.m.file, id))
+		if p.flags() == btreeFlagLeaf {
+			c.stack = append(c.stack, cursorFrame{page: p, idx: p.search(key)})
+			break
+		}
+		i := p.childIndex(key)
+		c.stack = append(c.stack, cursorFrame{page: p, idx: i})
+		id = p.child(i)
+	}
+	return c.current()
+}
+
+// Next moves the cursor to the following key. It returns nil at the end of
+// the tree.
+func (c *Cursor) Next() ([]byte, []byte) {
+	if len(c.stack) == 0 {
+		return nil, nil
+	}
+	c.stack[len(c.stack)-1].idx++
+	return c.current()
+}
+
+// current returns the entry under the cursor, first advancing to the next
+// leaf when the cursor ran past the end of its leaf.
+func (c *Cursor) current() ([]byte, []byte) {
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		if top.idx < top.page.count() {
+			if top.page.flags() == btreeFlagLeaf {
+				return top.page.key(top.idx), top.page.value(top.idx)
+			}
+			p := btreePage(mapPage(c.m.file, top.page.child(top.idx)))
+			c.stack = append(c.stack, cursorFrame{page: p})
+			continue
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+		if len(c.stack) > 0 {
+			c.stack[len(c.stack)-1].idx++
+		}
+	}
+	return nil, nil
+}
+
+// Close releases the snapshot held by the cursor.
+func (c *Cursor) Close() {
+	if c.m == nil {
+		return
+	}
+	c.t.releaseSnapshot(c.m, c.meta)
+	c.m, c.stack = nil, nil
+}
@@ -0,0 +1,244 @@
+package mmap_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestBTree(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := mmap.OpenBTree(fname, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		t.Fatalf("could not open tree: %+v", err)
+	}
+
+	const n = 5000
+	want := make(map[string]string, n)
+	rnd := rand.New(rand.NewSource(1))
+	for _, i := range rnd.Perm(n) {
+		k, v := fmt.Sprintf("key-%06d", i), fmt.Sprintf("value-%d", i*7)
+		want[k] = v
+		if err := tree.Put([]byte(k), []byte(v)); err != nil {
+			t.Fatalf("could not put %q: %+v", k, err)
+		}
+	}
+	for i := 0; i < n; i += 3 {
+		k := fmt.Sprintf("key-%06d", i)
+		ok, err := tree.Delete([]byte(k))
+		if err != nil || !ok {
+			t.Fatalf("could not delete %q: %v %+v", k, ok, err)
+		}
+		delete(want, k)
+	}
+	if ok, err := tree.Delete([]byte("missing")); err != nil || ok {
+		t.Fatalf("invalid delete of missing key: %v %+v", ok, err)
+	}
+	checkBTree(t, tree, want)
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("could not close tree: %+v", err)
+	}
+	tree, err = mmap.OpenBTree(fname, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("could not reopen tree: %+v", err)
+	}
+	defer tree.Close()
+	checkBTree(t, tree, want)
+
+	if err := tree.Put([]byte("k"), []byte("v")); err != mmap.ErrBadFileDesc {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+	}
+}
+
+func checkBTree(t *testing.T, tree *mmap.BTree, want map[string]string) {
+	t.Helper()
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	c := tree.Cursor()
+	defer c.Close()
+	i := 0
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if i >= len(keys) {
+			t.Fatalf("unexpected key %q", k)
+		}
+		if got, want := string(k), keys[i]; got != want {
+			t.Fatalf("invalid key at %d: got=%q, want=%q", i, got, want)
+		}
+		if got, want := string(v), want[keys[i]]; got != want {
+			t.Fatalf("invalid value for %q: got=%q, want=%q", k, got, want)
+		}
+		i++
+	}
+	if i != len(keys) {
+		t.Fatalf("invalid number of keys: got=%d, want=%d", i, len(keys))
+	}
+
+	k, _ := c.Seek([]byte("key-000099"))
+	if got, want := string(k), "key-000100"; got != want {
+		t.Fatalf("invalid seek: got=%q, want=%q", got, want)
+	}
+	if v, ok := tree.Get([]byte("key-000101")); !ok || string(v) != want["key-000101"] {
+		t.Fatalf("invalid get: got=%q, want=%q", v, want["key-000101"])
+	}
+	if _, ok := tree.Get([]byte("key-000099")); ok {
+		t.Fatal("deleted key still present")
+	}
+}
+
+func TestBTreeSnapshot(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "snapshot.db")
+	tree, err := mmap.OpenBTree(fname, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		t.Fatalf("could not open tree: %+v", err)
+	}
+	defer tree.Close()
+
+	value := bytes.Repeat([]byte{'v'}, 200)
+	for i := 0; i < 100; i++ {
+		if err := tree.Put([]byte(fmt.Sprintf("k%03d", i)), value); err != nil {
+			t.Fatalf("could not put: %+v", err)
+		}
+	}
+
+	c := tree.Cursor()
+	for i := 0; i < 100; i++ {
+		if _, err := tree.Delete([]byte(fmt.Sprintf("k%03d", i))); err != nil {
+			t.Fatalf("could not delete: %+v", err)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		if err := tree.Put([]byte(fmt.Sprintf("n%04d", i)), value); err != nil {
+			t.Fatalf("could not put: %+v", err)
+		}
+	}
+
+	n := 0
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if got, want := string(k), fmt.Sprintf("k%03d", n); got != want {
+			t.Fatalf("snapshot changed: got=%q, want=%q", got, want)
+		}
+		if !bytes.Equal(v, value) {
+			t.Fatalf("snapshot value changed for %q", k)
+		}
+		n++
+	}
+	c.Close()
+	if n != 100 {
+		t.Fatalf("invalid snapshot size: got=%d, want=%d", n, 100)
+	}
+
+	if _, ok := tree.Get([]byte("k000")); ok {
+		t.Fatal("deleted key still present")
+	}
+	if _, ok := tree.Get([]byte("n1999")); !ok {
+		t.Fatal("missing key n1999")
+	}
+}
+
+func TestBTreeFreelist(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "freelist.db")
+	tree, err := mmap.OpenBTree(fname, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		t.Fatalf("could not open tree: %+v", err)
+	}
+
+	value := bytes.Repeat([]byte{'v'}, 100)
+	fill := func(round int) {
+		for i := 0; i < 3000; i++ {
+			if err := tree.Put([]byte(fmt.Sprintf("%d-%05d", round, i)), value); err != nil {
+				t.Fatalf("could not put: %+v", err)
+			}
+		}
+		for i := 0; i < 3000; i++ {
+			if _, err := tree.Delete([]byte(fmt.Sprintf("%d-%05d", round, i))); err != nil {
+				t.Fatalf("could not delete: %+v", err)
+			}
+		}
+	}
+
+	fill(0)
+	if err := tree.Close(); err != nil {
+		t.Fatalf("could not close tree: %+v", err)
+	}
+	fi, err := os.Stat(fname)
+	if err != nil {
+		t.Fatalf("could not stat: %+v", err)
+	}
+
+	for round := 1; round < 4; round++ {
+		tree, err = mmap.OpenBTree(fname, os.O_RDWR)
+		if err != nil {
+			t.Fatalf("could not reopen tree: %+v", err)
+		}
+		fill(round)
+		if err := tree.Close(); err != nil {
+			t.Fatalf("could not close tree: %+v", err)
+		}
+	}
+	after, err := os.Stat(fname)
+	if err != nil {
+		t.Fatalf("could not stat: %+v", err)
+	}
+	if after.Size() != fi.Size() {
+		t.Fatalf("pages were not recycled: size %d -> %d", fi.Size(), after.Size())
+	}
+}
+
+func TestBTreeCloseWithCursor(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cursor.db")
+	tree, err := mmap.OpenBTree(fname, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		t.Fatalf("could not open tree: %+v", err)
+	}
+
+	want := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		k, v := fmt.Sprintf("k%03d", i), fmt.Sprintf("v%d", i)
+		want[k] = v
+		if err := tree.Put([]byte(k), []byte(v)); err != nil {
+			t.Fatalf("could not put: %+v", err)
+		}
+	}
+	c := tree.Cursor()
+	defer c.Close()
+	if err := tree.Put([]byte("k000"), []byte("changed")); err != nil {
+		t.Fatalf("could not put: %+v", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("could not close tree: %+v", err)
+	}
+
+	n := 0
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if string(v) != want[string(k)] {
+			t.Fatalf("snapshot changed for %q: got=%q, want=%q", k, v, want[string(k)])
+		}
+		n++
+	}
+	if n != len(want) {
+		t.Fatalf("invalid snapshot size: got=%d, want=%d", n, len(want))
+	}
+
+	tree, err = mmap.OpenBTree(fname, os.O_RDWR)
+	if err != nil {
+		t.Fatalf("could not reopen tree: %+v", err)
+	}
+	defer tree.Close()
+	if v, ok := tree.Get([]byte("k000")); !ok || string(v) != "changed" {
+		t.Fatalf("invalid get: got=%q, want=%q", v, "changed")
+	}
+	if v, ok := tree.Get([]byte("k199")); !ok || string(v) != want["k199"] {
+		t.Fatalf("invalid get: got=%q, want=%q", v, want["k199"])
+	}
+}
@@ -0,0 +1,164 @@
+package mmap
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// CacheOptions configures the budgets of a Cache. A zero value disables the
+// corresponding limit.
+type CacheOptions struct {
+	// MaxBytes bounds the total size of all cached mappings.
+	MaxBytes int64
+	// MaxMappings bounds the number of cached mappings.
+	MaxMappings int
+}
+
+// CacheStats reports the activity of a Cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Bytes     int64
+	Mappings  int
+}
+
+// Cache hands out shared, reference counted read-only mappings by path.
+//
+// Mappings that are not in use are evicted in least recently used order
+// whenever the cache exceeds its byte or mapping budget, which keeps the
+// process below limits such as vm.max_map_count. An evicted file is mapped
+// again on its next Acquire. Mappings in use are never evicted, so the
+// budgets may be exceeded temporarily while many files are held.
+type Cache struct {
+	opts CacheOptions
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	handles map[*MapFile]*cacheEntry
+	lru     *list.List // front is most recently used
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	path string
+	file *MapFile
+	refs int
+	elem *list.Element
+}
+
+// NewCache returns an empty cache with the given budgets.
+func NewCache(opts CacheOptions) *Cache {
+	return &Cache{
+		opts:    opts,
+		entries: make(map[string]*cacheEntry),
+		handles: make(map[*MapFile]*cacheEntry),
+		lru:     list.New(),
+	}
+}
+
+// Acquire returns the mapping of the named file, mapping it for reading
+// when it is not cached. Unlike Open, it never creates the file: a missing
+// file returns an error matching fs.ErrNotExist. Every successful Acquire
+// must be paired with a Release.
+//
+// Callers acquiring the same path share one *MapFile, including its offset
+// for Read and Seek, so only ReadAt and View are safe to use concurrently.
+func (c *Cache) Acquire(path string) (*MapFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e := c.entries[path]; e != nil {
+		c.stats.Hits++
+		e.refs++
+		c.lru.MoveToFront(e.elem)
+		return e.file, nil
+	}
+
+	c.stats.Misses++
+	f, err := openExisting(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &cacheEntry{path: path, file: f, refs: 1}
+	e.elem = c.lru.PushFront(e)
+	c.entries[path] = e
+	c.handles[f] = e
+	c.stats.Bytes += int64(f.Len())
+	c.stats.Mappings++
+	c.evict()
+	return f, nil
+}
+
+// Release returns a mapping obtained from Acquire to the cache. The mapping
+// must not be used afterwards.
+func (c *Cache) Release(f *MapFile) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.handles[f]
+	if e == nil || e.refs == 0 {
+		return fmt.Errorf("Cache: release of unknown mapping: %w", ErrInvalid)
+	}
+	e.refs--
+	c.evict()
+	return nil
+}
+
+// evict unmaps idle entries, oldest first, until the cache fits its budgets.
+func (c *Cache) evict() {
+	for el := c.lru.Back(); el != nil && c.over(); {
+		e := el.Value.(*cacheEntry)
+		el = el.Prev()
+		if e.refs > 0 {
+			continue
+		}
+		size := e.file.Len()
+		if err := c.remove(e); err != nil {
+			Log().Error("Cache.evict", "err", err, "path", e.path)
+		}
+		c.stats.Evictions++
+		if DebugLogEnabled() {
+			Log().Debug("Cache.evict", "path", e.path, "size", size)
+		}
+	}
+}
+
+func (c *Cache) over() bool {
+	return (c.opts.MaxBytes > 0 && c.stats.Bytes > c.opts.MaxBytes) ||
+		(c.opts.MaxMappings > 0 && c.stats.Mappings > c.opts.MaxMappings)
+}
+
+func (c *Cache) remove(e *cacheEntry) error {
+	c.lru.Remove(e.elem)
+	delete(c.entries, e.path)
+	delete(c.handles, e.file)
+	c.stats.Bytes -= int64(e.file.Len())
+	c.stats.Mappings--
+	return e.file.Close()
+}
+
+// Stats returns the current counters of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// Close unmaps every cached file, including the ones still in use, and
+// returns the errors of closing them.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, e := range c.entries {
+		if err := c.remove(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package mmap_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	names := make([]string, 5)
+	for i := range names {
+		names[i] = filepath.Join(dir, fmt.Sprintf("file-%d", i))
+		if err := os.WriteFile(names[i], bytes.Repeat([]byte{byte('a' + i)}, 1000), 0o644); err != nil {
+			t.Fatalf("could not seed file: %+v", err)
+		}
+	}
+
+	c := mmap.NewCache(mmap.CacheOptions{MaxBytes: 2500, MaxMappings: 3})
+	defer c.Close()
+
+	get := func(i int) *mmap.MapFile {
+		t.Helper()
+		f, err := c.Acquire(names[i])
+		if err != nil {
+			t.Fatalf("could not acquire %d: %+v", i, err)
+		}
+		if got, want := f.At(0), byte('a'+i); got != want {
+			t.Fatalf("invalid content: got=%q, want=%q", got, want)
+		}
+		return f
+	}
+
+	pinned := get(0)
+	for i := 1; i < 5; i++ {
+		if err := c.Release(get(i)); err != nil {
+			t.Fatalf("could not release %d: %+v", i, err)
+		}
+	}
+	st := c.Stats()
+	if st.Bytes > 2500 || st.Mappings > 3 {
+		t.Fatalf("budget exceeded: %+v", st)
+	}
+	if got, want := st.Evictions, uint64(3); got != want {
+		t.Fatalf("invalid evictions: got=%d, want=%d", got, want)
+	}
+
+	// The pinned file survived eviction and is a hit, the others were
+	// unmapped and are mapped again.
+	if err := c.Release(get(0)); err != nil {
+		t.Fatalf("could not release: %+v", err)
+	}
+	if err := c.Release(get(1)); err != nil {
+		t.Fatalf("could not release: %+v", err)
+	}
+	st = c.Stats()
+	if got, want := st.Hits, uint64(1); got != want {
+		t.Fatalf("invalid hits: got=%d, want=%d", got, want)
+	}
+	if got, want := st.Misses, uint64(6); got != want {
+		t.Fatalf("invalid misses: got=%d, want=%d", got, want)
+	}
+
+	if err := c.Release(pinned); err != nil {
+		t.Fatalf("could not release: %+v", err)
+	}
+	if err := c.Release(pinned); !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+}
+
+func TestCacheMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing")
+	c := mmap.NewCache(mmap.CacheOptions{})
+	defer c.Close()
+
+	if _, err := c.Acquire(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, fs.ErrNotExist)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Acquire created the file: %+v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Command mmapctl inspects and cleans up the SysV shared memory segments
+// created by the mmap package. It reports segment headers written with
+// WithHeader and the formats of the package stored in segments.
+//
+// Usage:
+//
+//	mmapctl ls [-a]                   list segments created by the package
+//	mmapctl dump ID|PATH [OFF [LEN]]  hexdump a segment or a mapped file
+//	mmapctl dump -id ID [OFF [LEN]]   hexdump a segment
+//	mmapctl dump -file PATH [OFF [LEN]]
+//	                                  hexdump a file, even one named by digits
+//	mmapctl rm ID...                  remove segments
+//	mmapctl gc [-a] [-n] [-o]         remove segments no process is attached to
+//
+// The -a flag includes segments created by other programs, -n only prints
+// what gc would remove, and -o also removes the segments of the package
+// whose creator is no longer running. Without -id or -file, dump takes an
+// argument made of digits for a segment id.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/godcong/mmap"
+)
+
+// headerSize is the number of bytes read to identify the format of a
+// segment.
+const headerSize = 128
+
+type region interface {
+	io.ReaderAt
+	io.Closer
+	Len() int
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "ls":
+		err = list(args)
+	case "dump":
+		err = dump(args)
+	case "rm":
+		err = remove(args)
+	case "gc":
+		err = gc(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mmapctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: mmapctl <command> [arguments]
+
+commands:
+  ls [-a]                  list segments created by the package
+  dump ID|PATH [OFF [LEN]] hexdump a segment or a mapped file
+  dump -id ID [OFF [LEN]]  hexdump a segment
+  dump -file PATH [OFF [LEN]]
+                           hexdump a file
+  rm ID...                 remove segments
+  gc [-a] [-n] [-o]        remove segments no process is attached to
+`)
+}
+
+func segments(all bool) ([]mmap.Segment, error) {
+	segs, err := mmap.Segments()
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return segs, nil
+	}
+	var managed []mmap.Segment
+	for _, s := range segs {
+		if s.Managed {
+			managed = append(managed, s)
+		}
+	}
+	return managed, nil
+}
+
+func list(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	all := fs.Bool("a", false, "list segments of other programs too")
+	_ = fs.Parse(args)
+
+	segs, err := segments(*all)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKEY\tSIZE\tMODE\tUID\tCPID\tLPID\tNATTCH\tHEADER\tFORMAT")
+	for _, s := range segs {
+		format, header := describe(s.ID)
+		fmt.Fprintf(w, "%d\t%#x\t%d\t%v\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			s.ID, uint32(s.Key), s.Size, s.Mode, s.UID, s.CreatorPID, s.LastPID, s.Attached, header, format)
+	}
+	return w.Flush()
+}
+
+// describe identifies the format and the segment header of segment id.
+// Either is "-" when it is unknown or the segment cannot be attached.
+func describe(id int) (format, header string) {
+	m, err := mmap.OpenMemWith(mmap.WithID(id))
+	if err != nil {
+		return "-", "-"
+	}
+	defer m.Close()
+	format, header = "-", "-"
+	if h, ok := m.Header(); ok {
+		header = fmt.Sprintf("type=%d,v%d", h.Type, h.Version)
+	}
+	b := make([]byte, min(headerSize, m.Len()))
+	if _, err := m.ReadAt(b, 0); err == nil {
+		if f := mmap.Identify(b); f != "" {
+			format = f
+		}
+	}
+	return format, header
+}
+
+func openSegment(arg string) (region, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id %q", arg)
+	}
+	return mmap.OpenMemWith(mmap.WithID(id))
+}
+
+// openFile maps the existing file at path. mmap.Open creates missing files,
+// which would turn a mistyped path into an empty file.
+func openFile(path string) (region, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return mmap.Open(path)
+}
+
+func dump(args []string) error {
+	const usage = "usage: dump [-id ID | -file PATH | ID|PATH] [OFF [LEN]]"
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	id := fs.String("id", "", "dump the segment `ID`")
+	file := fs.String("file", "", "dump the file at `PATH`")
+	_ = fs.Parse(args)
+	args = fs.Args()
+
+	var (
+		r   region
+		err error
+	)
+	switch {
+	case *id != "" && *file != "":
+		return errors.New(usage)
+	case *id != "":
+		r, err = openSegment(*id)
+	case *file != "":
+		r, err = openFile(*file)
+	case len(args) == 0:
+		return errors.New(usage)
+	default:
+		name := args[0]
+		args = args[1:]
+		if _, aerr := strconv.Atoi(name); aerr == nil {
+			r, err = openSegment(name)
+		} else {
+			r, err = openFile(name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if len(args) > 2 {
+		return errors.New(usage)
+	}
+
+	off, n := int64(0), int64(r.Len())
+	if len(args) > 0 {
+		if off, err = strconv.ParseInt(args[0], 0, 64); err != nil || off < 0 || off > int64(r.Len()) {
+			return fmt.Errorf("invalid offset %q", args[0])
+		}
+		n -= off
+	}
+	if len(args) > 1 {
+		l, err := strconv.ParseInt(args[1], 0, 64)
+		if err != nil || l < 0 {
+			return fmt.Errorf("invalid length %q", args[1])
+		}
+		n = min(n, l)
+	}
+
+	if m, ok := r.(*mmap.MapMem); ok {
+		if h, ok := m.Header(); ok {
+			fmt.Printf("# header: type %d, version %d, size %d, pid %d, created %s\n",
+				h.Type, h.Version, h.Size, h.PID, h.Created.Format(time.RFC3339))
+		}
+	}
+	head := make([]byte, min(headerSize, r.Len()))
+	if _, err := r.ReadAt(head, 0); err == nil {
+		if f := mmap.Identify(head); f != "" {
+			fmt.Printf("# format: %s\n", f)
+		}
+	}
+	d := hex.Dumper(os.Stdout)
+	if _, err := io.Copy(d, io.NewSectionReader(r, off, n)); err != nil {
+		return err
+	}
+	return d.Close()
+}
+
+func remove(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: rm ID...")
+	}
+	var errs []error
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid id %q", arg))
+			continue
+		}
+		if err := mmap.RemoveSegment(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func gc(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	all := fs.Bool("a", false, "remove segments of other programs too")
+	dryRun := fs.Bool("n", false, "only print the segments to remove")
+	orphans := fs.Bool("o", false, "also remove segments whose creator is no longer running")
+	_ = fs.Parse(args)
+
+	segs, err := segments(*all)
+	if err != nil {
+		return err
+	}
+	dead := make(map[int]bool)
+	if *orphans {
+		found, err := mmap.Orphans()
+		if err != nil {
+			return err
+		}
+		for _, s := range found {
+			dead[s.ID] = true
+		}
+	}
+	var errs []error
+	for _, s := range segs {
+		if s.Attached > 0 && !dead[s.ID] {
+			continue
+		}
+		fmt.Printf("remove %d (%d bytes)\n", s.ID, s.Size)
+		if *dryRun {
+			continue
+		}
+		if err := mmap.RemoveSegment(s.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
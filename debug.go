@@ -1,36 +1,59 @@
 package mmap
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"sync"
+	"sync/atomic"
 )
 
 var (
-	logger     *slog.Logger
-	loggerOnce sync.Once
-	debugMode  bool
+	logger        atomic.Pointer[slog.Logger]
+	defaultLogger *slog.Logger
+	loggerOnce    sync.Once
+	debugMode     bool
 )
 
 func init() {
-	debugMode = os.Getenv("GO_MMAP_DEBUG") != ""
+	if os.Getenv("GO_MMAP_DEBUG") != "" {
+		debugMode = true
+	}
 }
 
-// Log returns a structured logger for mmap operations
+// Log returns the structured logger for mmap operations. It is the logger
+// installed with SetLogger, or a text logger on os.Stderr that only records
+// errors unless debug mode is enabled with GO_MMAP_DEBUG or the debug build
+// tag.
 func Log() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
 	loggerOnce.Do(func() {
 		opts := &slog.HandlerOptions{}
-		if !debugMode {
-			opts.Level = slog.LevelError // 只记录错误级别日志
+		if debugMode {
+			opts.Level = slog.LevelDebug
+		} else {
+			opts.Level = slog.LevelError
 		}
-
-		handler := slog.NewTextHandler(os.Stdout, opts)
-		logger = slog.New(handler)
+		defaultLogger = slog.New(slog.NewTextHandler(os.Stderr, opts))
 	})
-	return logger
+	return defaultLogger
+}
+
+// SetLogger replaces the logger returned by Log. A nil logger restores the
+// default one. Handles with their own logger set with SetLogger on the
+// handle are not affected.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
 }
 
 // DebugLogEnabled returns whether debug logging is enabled
 func DebugLogEnabled() bool {
-	return debugMode
+	return debugMode || Log().Enabled(context.Background(), slog.LevelDebug)
+}
+
+// logEnabled reports whether l records messages at level.
+func logEnabled(l *slog.Logger, level slog.Level) bool {
+	return l.Enabled(context.Background(), level)
 }
@@ -3,5 +3,5 @@
 package mmap
 
 func init() {
-	debug = true
+	debugMode = true
 }
@@ -0,0 +1,43 @@
+package mmap_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestSetLogger(t *testing.T) {
+	var global, local bytes.Buffer
+	mmap.SetLogger(slog.New(slog.NewTextHandler(&global, nil)))
+	defer mmap.SetLogger(nil)
+
+	path := filepath.Join(t.TempDir(), "data")
+	f, err := mmap.OpenFileS(path, os.O_RDWR, 0o644, 4)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+
+	_, _ = f.WriteAt([]byte("hello"), 0)
+	out := global.String()
+	for _, want := range []string{"msg=MapFile.WriteAt", "op=WriteAt", "path=" + path} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in log:\n%s", want, out)
+		}
+	}
+
+	global.Reset()
+	f.SetLogger(slog.New(slog.NewTextHandler(&local, nil)))
+	_, _ = f.WriteAt([]byte("hello"), 0)
+	if global.Len() != 0 {
+		t.Fatalf("handle logger not used, global log:\n%s", global.String())
+	}
+	if !strings.Contains(local.String(), "op=WriteAt") {
+		t.Fatalf("missing op in handle log:\n%s", local.String())
+	}
+}
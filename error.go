@@ -3,7 +3,10 @@ package mmap
 import (
 	"errors"
 	"io"
+	"io/fs"
 	"os"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -12,4 +15,98 @@ var (
 	ErrShortWrite  = io.ErrShortWrite
 	ErrInvalid     = os.ErrInvalid
 	EOF            = io.EOF
+
+	// ErrInvalidFormat is returned when a mapping does not carry the
+	// expected on-disk layout.
+	ErrInvalidFormat = errors.New("invalid mapping format")
+	// ErrNoSpace is returned when a mapping has no room left for an
+	// allocation.
+	ErrNoSpace = errors.New("no space left in mapping")
+	// ErrTruncated is returned by a guarded MapFile when the mapped file
+	// shrank below the accessed range.
+	ErrTruncated = errors.New("mapped file truncated")
+	// ErrIO is returned by a guarded MapFile when the pages backing the
+	// accessed range could not be read or written.
+	ErrIO = errors.New("mapped file i/o error")
+	// ErrUnsupported is returned for options the platform cannot honour.
+	ErrUnsupported = errors.ErrUnsupported
+	// ErrPermission is returned when the caller may not create, attach to
+	// or change a mapping.
+	ErrPermission = fs.ErrPermission
+	// ErrNoHeader is returned when a segment attached with WithHeader
+	// carries no segment header.
+	ErrNoHeader = errors.New("no segment header")
 )
+
+// HeaderError reports a segment header that does not match the one
+// expected with WithHeader, or is corrupt. It matches ErrInvalidFormat.
+type HeaderError struct {
+	// Field is "checksum", "header version", "type", "version" or "size".
+	Field string
+	Got   uint64
+	Want  uint64
+}
+
+func (e *HeaderError) Error() string {
+	return "segment header " + e.Field + " mismatch: got " +
+		strconv.FormatUint(e.Got, 10) + ", want " + strconv.FormatUint(e.Want, 10)
+}
+
+func (e *HeaderError) Is(target error) bool {
+	return target == ErrInvalidFormat
+}
+
+// MapError records an error together with the operation, the mapping and
+// the byte range that caused it. Methods of MapFile and MapMem return their
+// errors as *MapError, except for io.EOF which is returned as is; use
+// errors.Is to test for ErrClosed, ErrShortWrite, ErrInvalid and the other
+// error values of this package.
+type MapError struct {
+	Op string
+	// Path is the mapped file, empty for shared memory.
+	Path string
+	// ID is the shared memory id, zero for files.
+	ID     int
+	Offset int64
+	Len    int
+	Err    error
+}
+
+func (e *MapError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	switch {
+	case e.Path != "":
+		b.WriteString(" ")
+		b.WriteString(e.Path)
+	case e.ID != 0:
+		b.WriteString(" id ")
+		b.WriteString(strconv.Itoa(e.ID))
+	}
+	if e.Offset != 0 || e.Len != 0 {
+		b.WriteString(" [offset ")
+		b.WriteString(strconv.FormatInt(e.Offset, 10))
+		b.WriteString(", len ")
+		b.WriteString(strconv.Itoa(e.Len))
+		b.WriteString("]")
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *MapError) Unwrap() error {
+	return e.Err
+}
+
+// underlyingError strips the *fs.PathError or *MapError err was wrapped in,
+// so the caller can attach its own context.
+func underlyingError(err error) error {
+	switch e := err.(type) {
+	case *fs.PathError:
+		return e.Err
+	case *MapError:
+		return e.Err
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package mmap_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestMapError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	f, err := mmap.OpenFileS(path, os.O_RDWR, 0o644, 16)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	m, err := mmap.OpenMem(mmap.MapMemKeyInvalid, 16)
+	if err != nil {
+		t.Fatalf("could not open mem: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		rw   interface {
+			io.ReadWriteSeeker
+			io.ReaderAt
+			io.WriterAt
+			io.Closer
+		}
+		op string
+	}{
+		{name: "file", rw: f, op: "MapFile."},
+		{name: "mem", rw: m, op: "MapMem."},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			check := func(err, want error, op string) {
+				t.Helper()
+				if !errors.Is(err, want) {
+					t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, want)
+				}
+				var me *mmap.MapError
+				if !errors.As(err, &me) {
+					t.Fatalf("error is not a *MapError: %T", err)
+				}
+				if got, want := me.Op, tc.op+op; got != want {
+					t.Fatalf("invalid op: got=%q, want=%q", got, want)
+				}
+			}
+
+			_, err := tc.rw.WriteAt([]byte("x"), -1)
+			check(err, mmap.ErrInvalid, "WriteAt")
+			_, err = tc.rw.ReadAt(make([]byte, 1), 1<<20)
+			check(err, mmap.ErrInvalid, "ReadAt")
+			_, err = tc.rw.Seek(0, 42)
+			check(err, mmap.ErrInvalid, "Seek")
+
+			n := int64(len(tc.rw.(mmap.Region).Bytes()))
+			_, err = tc.rw.WriteAt([]byte("xy"), n-1)
+			check(err, mmap.ErrShortWrite, "WriteAt")
+			var me *mmap.MapError
+			errors.As(err, &me)
+			if me.Offset != n-1 || me.Len != 2 {
+				t.Fatalf("invalid range: offset=%d, len=%d", me.Offset, me.Len)
+			}
+
+			if err := tc.rw.Close(); err != nil {
+				t.Fatalf("could not close: %+v", err)
+			}
+			_, err = tc.rw.Read(make([]byte, 1))
+			check(err, mmap.ErrClosed, "Read")
+			_, err = tc.rw.Write([]byte("x"))
+			check(err, mmap.ErrClosed, "Write")
+		})
+	}
+
+	_, err = f.ReadAt(nil, 0)
+	var me *mmap.MapError
+	if !errors.As(err, &me) || me.Path != path {
+		t.Fatalf("invalid path in %+v", err)
+	}
+	_, err = m.ReadAt(nil, 0)
+	if !errors.As(err, &me) || me.ID != m.ID() {
+		t.Fatalf("invalid id in %+v", err)
+	}
+}
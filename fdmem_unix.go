@@ -0,0 +1,196 @@
+//go:build linux || darwin || freebsd
+
+package mmap
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"runtime"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+const (
+	fdMemMagic = "MMFD"
+	// fdMemHeader is the size of the metadata sent before the tag: magic,
+	// access flags, tag length and size.
+	fdMemHeader = 16
+	// maxTagLen bounds the tag sent along with the memory.
+	maxTagLen = 4096
+
+	fdMemWritable = 1
+)
+
+func openMemfd(o *options) (*MapMem, error) {
+	start := now()
+	size := getPageSize(o.size)
+	f, err := newMemfd(o.tag)
+	if err != nil {
+		return nil, &MapError{Op: "MapMem.Open", Len: size, Err: err}
+	}
+	if err := f.Truncate(int64(size)); err != nil {
+		_ = f.Close()
+		return nil, &MapError{Op: "MapMem.Open", Len: size, Err: underlyingError(err)}
+	}
+	if o.permSet {
+		err = f.Chmod(o.segmentPerm())
+	}
+	if err == nil && (o.uid != -1 || o.gid != -1) {
+		err = f.Chown(o.uid, o.gid)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, &MapError{Op: "MapMem.Open", Len: size, Err: underlyingError(err)}
+	}
+	fd, err := mapFdMem(f, size, true, o.tag, o)
+	if err != nil {
+		_ = f.Close()
+		return nil, &MapError{Op: "MapMem.Open", Len: size, Err: err}
+	}
+	fd.observe(EventOpen, start, 0, 0, nil)
+	return fd, nil
+}
+
+// mapFdMem maps size bytes of f into a MapMem that owns f.
+func mapFdMem(f *os.File, size int, writable bool, tag string, o *options) (*MapMem, error) {
+	prot := PROT_READ
+	if writable {
+		prot |= PROT_WRITE
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, prot, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	if o.thp {
+		if err := adviseHugePages(data); err != nil {
+			o.log().Warn("MapMem.Open", "op", "Open", "tag", tag, "err", err)
+		}
+	}
+	if o.populate {
+		_ = prefault(context.Background(), data, nil)
+	}
+
+	fd := &MapMem{
+		owner:    writable,
+		writable: writable,
+		data:     data,
+		file:     f,
+		tag:      tag,
+		close:    f.Close,
+		unmap:    unmapAnon,
+		logger:   o.logger,
+	}
+	fd.reg = mappings.add(MappingInfo{
+		Kind:  "fd",
+		Path:  tag,
+		Size:  size,
+		Prot:  prot,
+		Owner: writable,
+	})
+	runtime.SetFinalizer(fd, finalizeMapMem)
+	return fd, nil
+}
+
+// SendTo sends the memory of f to the peer of conn as a file descriptor,
+// together with its size, its access and its tag. The peer receives it with
+// ReceiveMem. Only memory created with WithMemfd or received with
+// ReceiveMem can be sent; SysV segments return ErrUnsupported.
+func (f *MapMem) SendTo(conn *net.UnixConn) error {
+	if f == nil {
+		return &MapError{Op: "MapMem.SendTo", Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return f.error("SendTo", 0, 0, ErrClosed)
+	}
+	if f.file == nil {
+		return f.error("SendTo", 0, 0, ErrUnsupported)
+	}
+	if len(f.tag) > maxTagLen {
+		return f.error("SendTo", 0, 0, ErrInvalid)
+	}
+
+	meta := make([]byte, fdMemHeader+len(f.tag))
+	copy(meta, fdMemMagic)
+	if f.writable {
+		meta[4] = fdMemWritable
+	}
+	binary.LittleEndian.PutUint16(meta[6:], uint16(len(f.tag)))
+	binary.LittleEndian.PutUint64(meta[8:], uint64(len(f.data)))
+	copy(meta[fdMemHeader:], f.tag)
+
+	rights := syscall.UnixRights(int(f.file.Fd()))
+	if _, _, err := conn.WriteMsgUnix(meta, rights, nil); err != nil {
+		return f.error("SendTo", 0, len(f.data), underlyingError(err))
+	}
+	runtime.KeepAlive(f.file)
+	return nil
+}
+
+// ReceiveMem receives memory sent with SendTo from conn and maps it. The
+// returned MapMem is writable when the sender's was, and reports the tag
+// of the sender. WithLogger, WithPopulate and WithTransparentHugePages
+// apply.
+func ReceiveMem(conn *net.UnixConn, opts ...Option) (*MapMem, error) {
+	start := now()
+	o := newOptions(opts)
+	fail := func(err error) (*MapMem, error) {
+		return nil, &MapError{Op: "MapMem.Receive", Err: err}
+	}
+
+	meta := make([]byte, fdMemHeader+maxTagLen)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, flags, _, err := conn.ReadMsgUnix(meta, oob)
+	if err != nil {
+		return fail(underlyingError(err))
+	}
+	fds, err := parseRights(oob[:oobn])
+	if err != nil {
+		return fail(err)
+	}
+	if len(fds) != 1 || flags&syscall.MSG_CTRUNC != 0 || n < fdMemHeader ||
+		string(meta[:4]) != fdMemMagic {
+		for _, fd := range fds {
+			_ = syscall.Close(fd)
+		}
+		return fail(ErrInvalidFormat)
+	}
+
+	tagLen := int(binary.LittleEndian.Uint16(meta[6:]))
+	size := binary.LittleEndian.Uint64(meta[8:])
+	f := os.NewFile(uintptr(fds[0]), "memfd")
+	if n != fdMemHeader+tagLen || size == 0 || size != uint64(int(size)) {
+		_ = f.Close()
+		return fail(ErrInvalidFormat)
+	}
+	tag := string(meta[fdMemHeader:n])
+	if fi, err := f.Stat(); err != nil || fi.Size() < int64(size) {
+		_ = f.Close()
+		return fail(ErrInvalid)
+	}
+
+	fd, err := mapFdMem(f, int(size), meta[4]&fdMemWritable != 0, tag, o)
+	if err != nil {
+		_ = f.Close()
+		return fail(err)
+	}
+	fd.observe(EventOpen, start, 0, 0, nil)
+	return fd, nil
+}
+
+func parseRights(oob []byte) ([]int, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, os.NewSyscallError("ParseSocketControlMessage", err)
+	}
+	var fds []int
+	for i := range msgs {
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
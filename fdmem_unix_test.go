@@ -0,0 +1,81 @@
+//go:build linux || darwin || freebsd
+
+package mmap_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/godcong/mmap"
+	"golang.org/x/sys/unix"
+)
+
+func socketPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatalf("could not create socket pair: %+v", err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socket")
+		c, err := net.FileConn(f)
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf("could not create conn: %+v", err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+		conns[i] = c.(*net.UnixConn)
+	}
+	return conns[0], conns[1]
+}
+
+func TestSendReceiveMem(t *testing.T) {
+	a, b := socketPair(t)
+
+	m, err := mmap.OpenMemWith(mmap.WithSize(8192), mmap.WithMemfd(), mmap.WithTag("table"))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if _, err := m.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	if err := m.SendTo(a); err != nil {
+		t.Fatalf("could not send: %+v", err)
+	}
+
+	r, err := mmap.ReceiveMem(b)
+	if err != nil {
+		t.Fatalf("could not receive: %+v", err)
+	}
+	defer r.Close()
+	if got, want := r.Len(), m.Len(); got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+	if got, want := r.Tag(), "table"; got != want {
+		t.Fatalf("invalid tag: got=%q, want=%q", got, want)
+	}
+	buf := make([]byte, 5)
+	if _, err := r.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+		t.Fatalf("invalid read: %q, %+v", buf, err)
+	}
+
+	if _, err := r.WriteAt([]byte("world"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	if _, err := m.ReadAt(buf, 0); err != nil || string(buf) != "world" {
+		t.Fatalf("write not visible: %q, %+v", buf, err)
+	}
+
+	shm, err := mmap.OpenMemWith(mmap.WithSize(4096))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer shm.Close()
+	if err := shm.SendTo(a); !errors.Is(err, mmap.ErrUnsupported) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrUnsupported)
+	}
+}
@@ -0,0 +1,19 @@
+package mmap
+
+import (
+	"net"
+)
+
+func openMemfd(o *options) (*MapMem, error) {
+	return nil, &MapError{Op: "MapMem.Open", Len: o.size, Err: ErrUnsupported}
+}
+
+// SendTo is unsupported on Windows.
+func (f *MapMem) SendTo(conn *net.UnixConn) error {
+	return &MapError{Op: "MapMem.SendTo", ID: f.id, Err: ErrUnsupported}
+}
+
+// ReceiveMem is unsupported on Windows.
+func ReceiveMem(conn *net.UnixConn, opts ...Option) (*MapMem, error) {
+	return nil, &MapError{Op: "MapMem.Receive", Err: ErrUnsupported}
+}
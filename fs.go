@@ -0,0 +1,218 @@
+package mmap
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FS is a read-only fs.FS over a directory that serves regular files from
+// memory mappings. Every file is mapped once with Open, and the mapping is
+// shared by all handles opened on it; it is unmapped when the last handle is
+// closed.
+//
+// Files returned by FS implement io.ReaderAt and io.Seeker, so they can be
+// served by http.FileServer and http.ServeContent straight from the mapping.
+type FS struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*fsEntry
+}
+
+type fsEntry struct {
+	name string
+	file *MapFile
+	info fs.FileInfo
+	refs int
+}
+
+// NewFS returns a file system rooted at dir.
+func NewFS(dir string) *FS {
+	return &FS{
+		dir:   dir,
+		files: make(map[string]*fsEntry),
+	}
+}
+
+func (fsys *FS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(fsys.dir, filepath.FromSlash(name)), nil
+}
+
+// Open implements fs.FS. Directories and other non-regular files are
+// opened with os.Open.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	full, err := fsys.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: underlyingError(err)}
+	}
+	if !fi.Mode().IsRegular() {
+		return os.Open(full)
+	}
+
+	e, err := fsys.acquire(name, full, fi)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: underlyingError(err)}
+	}
+	return &fsFile{fsys: fsys, entry: e}, nil
+}
+
+// ReadFile implements fs.ReadFileFS. It returns a copy of the mapped file.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mf, ok := f.(*fsFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	data := make([]byte, len(mf.entry.file.data))
+	copy(data, mf.entry.file.data)
+	return data, nil
+}
+
+// Stat implements fs.StatFS.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	full, err := fsys.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: underlyingError(err)}
+	}
+	return fi, nil
+}
+
+// acquire returns the cached mapping of name, mapping the file when it is
+// not cached yet or when it changed on disk since it was mapped. A file
+// removed since it was stat'ed is not created again.
+func (fsys *FS) acquire(name, full string, fi fs.FileInfo) (*fsEntry, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if e := fsys.files[name]; e != nil &&
+		e.info.Size() == fi.Size() && e.info.ModTime().Equal(fi.ModTime()) {
+		e.refs++
+		return e, nil
+	}
+
+	f, err := openExisting(full)
+	if err != nil {
+		return nil, err
+	}
+	e := &fsEntry{name: name, file: f, info: fi, refs: 1}
+	fsys.files[name] = e
+	if DebugLogEnabled() {
+		Log().Debug("FS.acquire", "path", full, "size", fi.Size())
+	}
+	return e, nil
+}
+
+func (fsys *FS) release(e *fsEntry) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if e.refs--; e.refs > 0 {
+		return nil
+	}
+	if fsys.files[e.name] == e {
+		delete(fsys.files, e.name)
+	}
+	return e.file.Close()
+}
+
+// fsFile is a handle on a mapped file with its own read offset.
+type fsFile struct {
+	fsys   *FS
+	entry  *fsEntry
+	off    int64
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, f.error("stat", fs.ErrClosed)
+	}
+	return f.entry.info, nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, f.error("read", fs.ErrClosed)
+	}
+	if off < 0 {
+		return 0, f.error("read", fs.ErrInvalid)
+	}
+	data := f.entry.file.data
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, f.error("seek", fs.ErrClosed)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.entry.file.data))
+	default:
+		return 0, f.error("seek", fs.ErrInvalid)
+	}
+	if offset < 0 {
+		return 0, f.error("seek", fs.ErrInvalid)
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return f.error("close", fs.ErrClosed)
+	}
+	f.closed = true
+	return f.fsys.release(f.entry)
+}
+
+func (f *fsFile) error(op string, err error) error {
+	return &fs.PathError{Op: op, Path: f.entry.name, Err: err}
+}
+
+var (
+	_ fs.FS         = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.File       = (*fsFile)(nil)
+	_ io.ReaderAt   = (*fsFile)(nil)
+	_ io.Seeker     = (*fsFile)(nil)
+)
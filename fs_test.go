@@ -0,0 +1,90 @@
+package mmap
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"hello.txt":     "hello world!\n",
+		"empty.txt":     "",
+		"sub/bye.txt":   "bye.\n",
+		"sub/deep/x.md": "# x\n",
+	} {
+		fname := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fname), 0o755); err != nil {
+			t.Fatalf("could not create dir: %+v", err)
+		}
+		if err := os.WriteFile(fname, []byte(content), 0o644); err != nil {
+			t.Fatalf("could not seed file: %+v", err)
+		}
+	}
+
+	fsys := NewFS(dir)
+	if err := fstest.TestFS(fsys, "hello.txt", "empty.txt", "sub/bye.txt", "sub/deep/x.md"); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(fsys.files); got != 0 {
+		t.Fatalf("mappings left after closing all files: %d", got)
+	}
+
+	t.Run("refcount", func(t *testing.T) {
+		a, err := fsys.Open("hello.txt")
+		if err != nil {
+			t.Fatalf("could not open: %+v", err)
+		}
+		b, err := fsys.Open("hello.txt")
+		if err != nil {
+			t.Fatalf("could not open: %+v", err)
+		}
+		if a.(*fsFile).entry != b.(*fsFile).entry {
+			t.Fatal("mapping was not shared")
+		}
+		if err := a.Close(); err != nil {
+			t.Fatalf("could not close: %+v", err)
+		}
+		got := make([]byte, 5)
+		if _, err := b.(io.ReaderAt).ReadAt(got, 6); err != nil {
+			t.Fatalf("could not read after closing sibling: %+v", err)
+		}
+		if string(got) != "world" {
+			t.Fatalf("invalid content: got=%q, want=%q", got, "world")
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("could not close: %+v", err)
+		}
+		if got := len(fsys.files); got != 0 {
+			t.Fatalf("mapping left after last close: %d", got)
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		srv := httptest.NewServer(http.FileServer(http.FS(fsys)))
+		defer srv.Close()
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/hello.txt", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %+v", err)
+		}
+		req.Header.Set("Range", "bytes=6-10")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("could not get: %+v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read body: %+v", err)
+		}
+		if resp.StatusCode != http.StatusPartialContent || string(body) != "world" {
+			t.Fatalf("invalid response: %d %q", resp.StatusCode, body)
+		}
+	})
+}
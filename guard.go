@@ -0,0 +1,187 @@
+package mmap
+
+import (
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// SetGuarded turns the guarded access mode of f on or off.
+//
+// Touching pages of a mapping whose file was truncated by another process,
+// or whose backing store failed, raises SIGBUS and crashes the program. In
+// guarded mode Read, ReadByte, ReadAt, Write, WriteByte, WriteAt and View
+// catch such faults and return ErrTruncated or ErrIO instead, and At panics
+// with that error. They fstat the file before every access so the mapping
+// follows the file when its size changes. Private mappings made with
+// WithPrivate are not remapped, as that would drop their copy-on-write
+// changes. Slices returned by Bytes are not guarded; use View for
+// zero-copy access.
+func (f *MapFile) SetGuarded(on bool) {
+	f.guarded = on
+}
+
+// Guarded reports whether f is in guarded access mode.
+func (f *MapFile) Guarded() bool {
+	return f.guarded
+}
+
+// View calls fn with the n bytes of the mapping at off. The slice aliases
+// the mapping and must not be retained after fn returns. In guarded mode a
+// fault while fn runs is returned as ErrTruncated or ErrIO.
+func (f *MapFile) View(off int64, n int, fn func(b []byte) error) error {
+	if f == nil {
+		return &MapError{Op: "MapFile.View", Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return f.error("View", off, n, ErrClosed)
+	}
+	if err := f.refreshStale("View"); err != nil {
+		return err
+	}
+	if off < 0 || n < 0 || int64(len(f.data)) < off+int64(n) {
+		return f.error("View", off, n, ErrInvalid)
+	}
+	var err error
+	if gerr := f.guard("View", off, n, func() { err = fn(f.data[off : off+int64(n)]) }); gerr != nil {
+		return gerr
+	}
+	return err
+}
+
+// Refresh checks the size of the mapped file and remaps it when the file
+// grew or shrank since it was mapped. Remapping a private mapping made with
+// WithPrivate discards its copy-on-write changes.
+func (f *MapFile) Refresh() error {
+	if f == nil {
+		return &MapError{Op: "MapFile.Refresh", Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return f.error("Refresh", 0, 0, ErrClosed)
+	}
+	return f.refresh("Refresh")
+}
+
+// refreshStale remaps f when it is guarded or a watch saw its file change
+// size, unless f is private.
+func (f *MapFile) refreshStale(op string) error {
+	if f.flags&MAP_PRIVATE != 0 {
+		return nil
+	}
+	if f.guarded || f.stale.Load() {
+		return f.refresh(op)
+	}
+	return nil
+}
+
+func (f *MapFile) refresh(op string) error {
+	f.stale.Store(false)
+	fi, err := f.fd.Stat()
+	if err != nil {
+		return f.error(op, 0, len(f.data), underlyingError(err))
+	}
+	size := max(fi.Size()-f.offset, 0)
+	if size == int64(len(f.data)) {
+		return nil
+	}
+	if err := f.remap(size); err != nil {
+		return f.error(op, 0, int(size), err)
+	}
+	return nil
+}
+
+// remap replaces the mapping of f with one of size bytes from its offset.
+func (f *MapFile) remap(size int64) error {
+	if size < 0 || size != int64(int(size)) {
+		return ErrInvalid
+	}
+	f.logOp(slog.LevelDebug, "remap", "old", len(f.data), "new", size)
+	start := now()
+	if len(f.data) > 0 {
+		if err := Munmap(f.data); err != nil {
+			return os.NewSyscallError("munmap", err)
+		}
+	}
+	f.data = []byte{}
+	if f.off > int(size) {
+		f.off = int(size)
+	}
+	if size > 0 {
+		data, err := Mmap(int(f.fd.Fd()), f.offset, int(size), f.prot, f.flags)
+		if err != nil {
+			return err
+		}
+		f.data = data
+		if f.thp {
+			if err := adviseHugePages(data); err != nil {
+				f.logOp(slog.LevelWarn, "remap", "err", err)
+			}
+		}
+	}
+
+	if f.reg == 0 {
+		f.reg = mappings.add(MappingInfo{
+			Kind:  "file",
+			Path:  f.path,
+			Size:  len(f.data),
+			Prot:  f.prot,
+			Owner: f.writable,
+		})
+		runtime.SetFinalizer(f, finalizeMapFile)
+	} else {
+		mappings.resize(f.reg, len(f.data))
+	}
+	f.observe(EventRemap, start, 0, int(size), nil)
+	return nil
+}
+
+// guard runs fn, which accesses the mapping of f at off. In guarded mode a
+// memory fault raised by fn is recovered and returned as an error.
+func (f *MapFile) guard(op string, off int64, n int, fn func()) (err error) {
+	if !f.guarded {
+		fn()
+		return nil
+	}
+
+	old := debug.SetPanicOnFault(true)
+	defer func() {
+		debug.SetPanicOnFault(old)
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(interface{ Addr() uintptr }); !ok {
+			panic(r)
+		}
+		err = f.error(op, off, n, f.faultError(off, n))
+		f.logOp(slog.LevelError, op, "err", err)
+		f.observe(EventFault, time.Time{}, off, n, err)
+	}()
+	fn()
+	return nil
+}
+
+// faultError tells a fault caused by truncation of the file from one
+// caused by an I/O error, and remaps f to the current file size unless it
+// is private.
+func (f *MapFile) faultError(off int64, n int) error {
+	fi, err := f.fd.Stat()
+	if err != nil {
+		return ErrIO
+	}
+	size := max(fi.Size()-f.offset, 0)
+	if size == int64(len(f.data)) {
+		return ErrIO
+	}
+	if f.flags&MAP_PRIVATE == 0 {
+		if err := f.remap(size); err != nil {
+			f.logOp(slog.LevelError, "remap", "err", err)
+		}
+	}
+	if size < off+int64(n) {
+		return ErrTruncated
+	}
+	return ErrIO
+}
@@ -0,0 +1,137 @@
+//go:build linux || darwin || freebsd
+
+package mmap_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestGuarded(t *testing.T) {
+	page := os.Getpagesize()
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'a'}, 3*page), 0o644); err != nil {
+		t.Fatalf("could not seed file: %+v", err)
+	}
+
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	f.SetGuarded(true)
+
+	// Truncating the file while a view is in use faults on the next touch
+	// of a missing page.
+	err = f.View(0, 3*page, func(b []byte) error {
+		if err := os.Truncate(path, int64(page)); err != nil {
+			t.Fatalf("could not truncate: %+v", err)
+		}
+		if b[2*page] != 'a' {
+			return errors.New("unexpected content")
+		}
+		return nil
+	})
+	if !errors.Is(err, mmap.ErrTruncated) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrTruncated)
+	}
+	if got, want := f.Len(), page; got != want {
+		t.Fatalf("invalid length after fault: got=%d, want=%d", got, want)
+	}
+
+	// The mapping follows the file when it grows again.
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	if _, err := w.Write([]byte("tail")); err != nil {
+		t.Fatalf("could not append: %+v", err)
+	}
+	w.Close()
+
+	buf := make([]byte, 4)
+	if _, err := f.ReadAt(buf, int64(page)); err != nil {
+		t.Fatalf("could not read-at: %+v", err)
+	}
+	if got, want := buf, []byte("tail"); !bytes.Equal(got, want) {
+		t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+	}
+	if got, want := f.Len(), page+4; got != want {
+		t.Fatalf("invalid length after refresh: got=%d, want=%d", got, want)
+	}
+}
+
+func TestGuardedByte(t *testing.T) {
+	page := os.Getpagesize()
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'a'}, 3*page), 0o644); err != nil {
+		t.Fatalf("could not seed file: %+v", err)
+	}
+	f, err := mmap.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	f.SetGuarded(true)
+	if _, err := f.Seek(int64(2*page), io.SeekStart); err != nil {
+		t.Fatalf("could not seek: %+v", err)
+	}
+	if err := os.Truncate(path, int64(page)); err != nil {
+		t.Fatalf("could not truncate: %+v", err)
+	}
+
+	// The byte accessors follow the file instead of touching missing pages.
+	if _, err := f.ReadByte(); err != io.EOF {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, io.EOF)
+	}
+	if err := f.WriteByte('b'); !errors.Is(err, mmap.ErrShortWrite) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrShortWrite)
+	}
+	if err := os.Truncate(path, int64(page/2)); err != nil {
+		t.Fatalf("could not truncate: %+v", err)
+	}
+	if got, want := f.At(0), byte('a'); got != want {
+		t.Fatalf("invalid byte: got=%q, want=%q", got, want)
+	}
+	if got, want := f.Len(), page/2; got != want {
+		t.Fatalf("invalid length after At: got=%d, want=%d", got, want)
+	}
+}
+
+func TestGuardedPrivate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatalf("could not seed file: %+v", err)
+	}
+	f, err := mmap.OpenFileWith(path, mmap.WithPrivate())
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	f.SetGuarded(true)
+	if _, err := f.WriteAt([]byte("j"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+
+	// Growing the file does not remap the private mapping, which would
+	// drop the change.
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	if _, err := w.Write([]byte(" world")); err != nil {
+		t.Fatalf("could not append: %+v", err)
+	}
+	w.Close()
+
+	buf := make([]byte, 5)
+	if _, err := f.ReadAt(buf, 0); err != nil || string(buf) != "jello" {
+		t.Fatalf("invalid read: %q, %+v", buf, err)
+	}
+}
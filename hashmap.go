@@ -0,0 +1,581 @@
+package mmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	// HashMapVarSize marks keys or values of a HashMap as variable-size.
+	HashMapVarSize = 0
+
+	hashMapMagic      = 0x4d484d4d // "MMHM"
+	hashMapVersion    = 1
+	hashMapHeaderSize = 64
+	hashMapVarSlot    = 24
+	hashMapMinSlots   = 16
+
+	slotEmpty   = 0
+	slotDeleted = 1
+
+	// hashMapMovedOff holds flags of the file; hashMapMoved marks a file
+	// that grow replaced by a new one at the same path.
+	hashMapMovedOff = 56
+	hashMapMoved    = 1
+)
+
+// HashMap is an open-addressing hash table stored in a memory-mapped file.
+//
+// The file starts with a 64 byte header followed by the slot array. Tables
+// with fixed-size keys and values store them inline in the slots; tables
+// with variable-size keys or values keep them in an append-only heap after
+// the slots. The table grows by rehashing into a new file which replaces the
+// old one.
+//
+// A HashMap opened read-only never copies data: values returned by Get
+// point directly into the mapping. Other processes may open the same file
+// concurrently, the mapping is shared with MAP_SHARED. When the writer
+// grows the table it marks the old file as moved, and the other processes
+// reopen the path on their next access. Only one process may write.
+type HashMap struct {
+	mu   sync.RWMutex
+	path string
+	file *MapFile
+	// followed holds the mappings that follow replaced. They stay mapped
+	// until Close, so slices returned by Get remain valid.
+	followed []*MapFile
+
+	keySize   int
+	valueSize int
+	slotSize  int
+	slots     int
+}
+
+// CreateHashMap creates (or truncates) the named file and initialises an
+// empty hash map able to hold capacity entries before growing.
+// Use HashMapVarSize for keySize or valueSize to allow variable-size data.
+func CreateHashMap(path string, keySize, valueSize, capacity int) (*HashMap, error) {
+	if keySize < 0 || valueSize < 0 || capacity < 0 {
+		return nil, ErrInvalid
+	}
+	slots := hashMapMinSlots
+	for slots*3/4 < capacity {
+		slots <<= 1
+	}
+	heap := 0
+	if keySize == HashMapVarSize || valueSize == HashMapVarSize {
+		heap = pageSize
+	}
+	return createHashMap(path, keySize, valueSize, slots, heap)
+}
+
+// OpenHashMap opens an existing hash map. Pass os.O_RDONLY to share the
+// table read-only, or os.O_RDWR to modify it.
+func OpenHashMap(path string, flag int) (*HashMap, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	f, err := OpenFile(path, flag&^os.O_CREATE, 0)
+	if err != nil {
+		return nil, err
+	}
+	m := &HashMap{path: path, file: f}
+	if err := m.load(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func createHashMap(path string, keySize, valueSize, slots, heap int) (*HashMap, error) {
+	m := &HashMap{
+		path:      path,
+		keySize:   keySize,
+		valueSize: valueSize,
+		slots:     slots,
+	}
+	m.slotSize = hashMapSlotSize(keySize, valueSize)
+	heapOff := hashMapHeaderSize + slots*m.slotSize
+	size := heapOff + heap
+
+	if err := os.Truncate(path, 0); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := OpenFileS(path, os.O_RDWR|os.O_CREATE, 0o644, size)
+	if err != nil {
+		return nil, err
+	}
+	m.file = f
+
+	h := f.data[:hashMapHeaderSize]
+	binary.LittleEndian.PutUint32(h[0:], hashMapMagic)
+	binary.LittleEndian.PutUint32(h[4:], hashMapVersion)
+	binary.LittleEndian.PutUint32(h[8:], uint32(keySize))
+	binary.LittleEndian.PutUint32(h[12:], uint32(valueSize))
+	binary.LittleEndian.PutUint64(h[16:], uint64(slots))
+	binary.LittleEndian.PutUint64(h[24:], 0)
+	binary.LittleEndian.PutUint64(h[32:], 0)
+	binary.LittleEndian.PutUint64(h[40:], uint64(heapOff))
+	binary.LittleEndian.PutUint64(h[48:], uint64(heapOff))
+	return m, nil
+}
+
+func hashMapSlotSize(keySize, valueSize int) int {
+	if keySize == HashMapVarSize || valueSize == HashMapVarSize {
+		return hashMapVarSlot
+	}
+	return (8 + keySize + valueSize + 7) &^ 7
+}
+
+func (m *HashMap) load() error {
+	data := m.file.data
+	if len(data) < hashMapHeaderSize ||
+		binary.LittleEndian.Uint32(data[0:]) != hashMapMagic {
+		return fmt.Errorf("HashMap: %q: %w", m.path, ErrInvalidFormat)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != hashMapVersion {
+		return fmt.Errorf("HashMap: %q: unsupported version %d: %w", m.path, v, ErrInvalidFormat)
+	}
+	m.keySize = int(binary.LittleEndian.Uint32(data[8:]))
+	m.valueSize = int(binary.LittleEndian.Uint32(data[12:]))
+	m.slots = int(binary.LittleEndian.Uint64(data[16:]))
+	m.slotSize = hashMapSlotSize(m.keySize, m.valueSize)
+	if m.slots <= 0 || m.slots&(m.slots-1) != 0 || m.slots > len(data)/m.slotSize ||
+		hashMapHeaderSize+m.slots*m.slotSize > len(data) ||
+		m.heapStart() < hashMapHeaderSize+m.slots*m.slotSize ||
+		m.heapEnd() < m.heapStart() || m.heapEnd() > len(data) {
+		return fmt.Errorf("HashMap: %q: corrupt header: %w", m.path, ErrInvalidFormat)
+	}
+	if m.variable() {
+		for i := 0; i < m.slots; i++ {
+			s := m.slot(i)
+			if binary.LittleEndian.Uint64(s) <= slotDeleted {
+				continue
+			}
+			if _, _, err := m.entry(s); err != nil {
+				return fmt.Errorf("HashMap: %q: slot %d: %w", m.path, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// moved reports whether another HashMap grew the table into a new file.
+func (m *HashMap) moved() bool {
+	return m.header(hashMapMovedOff)&hashMapMoved != 0
+}
+
+// follow reopens the path of m when the mapped file was replaced by grow.
+// The old mapping is kept until Close, as other goroutines may still hold
+// slices of it.
+func (m *HashMap) follow() error {
+	if m.file.data == nil || !m.moved() {
+		return nil
+	}
+	flag := os.O_RDONLY
+	if m.file.Writable() {
+		flag = os.O_RDWR
+	}
+	f, err := OpenFile(m.path, flag, 0)
+	if err != nil {
+		return err
+	}
+	old := m.file
+	m.file = f
+	if err := m.load(); err != nil {
+		m.file = old
+		_ = f.Close()
+		return err
+	}
+	m.followed = append(m.followed, old)
+	return nil
+}
+
+// rlock read-locks m, first following the table to its new file when it
+// was grown by another process.
+func (m *HashMap) rlock() error {
+	for {
+		m.mu.RLock()
+		if m.file.data == nil || !m.moved() {
+			return nil
+		}
+		m.mu.RUnlock()
+		m.mu.Lock()
+		err := m.follow()
+		m.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *HashMap) variable() bool {
+	return m.keySize == HashMapVarSize || m.valueSize == HashMapVarSize
+}
+
+func (m *HashMap) header(off int) uint64 {
+	return binary.LittleEndian.Uint64(m.file.data[off:])
+}
+
+func (m *HashMap) setHeader(off int, v uint64) {
+	binary.LittleEndian.PutUint64(m.file.data[off:], v)
+}
+
+func (m *HashMap) count() int      { return int(m.header(24)) }
+func (m *HashMap) tombstones() int { return int(m.header(32)) }
+func (m *HashMap) heapStart() int  { return int(m.header(40)) }
+func (m *HashMap) heapEnd() int    { return int(m.header(48)) }
+
+func (m *HashMap) slot(i int) []byte {
+	off := hashMapHeaderSize + i*m.slotSize
+	return m.file.data[off : off+m.slotSize]
+}
+
+// entry returns the key and value stored in slot s. It returns
+// ErrInvalidFormat when the slot points outside of the heap.
+func (m *HashMap) entry(s []byte) (key, value []byte, err error) {
+	if !m.variable() {
+		key = s[8 : 8+m.keySize]
+		value = s[8+m.keySize : 8+m.keySize+m.valueSize]
+		return key, value, nil
+	}
+	off := binary.LittleEndian.Uint64(s[8:])
+	klen := uint64(binary.LittleEndian.Uint32(s[16:]))
+	vlen := uint64(binary.LittleEndian.Uint32(s[20:]))
+	if off < uint64(m.heapStart()) || off > uint64(len(m.file.data)) ||
+		klen+vlen > uint64(len(m.file.data))-off {
+		return nil, nil, fmt.Errorf("HashMap: heap entry at %d: %w", off, ErrInvalidFormat)
+	}
+	data := m.file.data[off : off+klen+vlen]
+	return data[:klen:klen], data[klen:], nil
+}
+
+// find returns the slot holding key, or the first free slot of its probe
+// sequence and false when the key is absent.
+func (m *HashMap) find(key []byte, tag uint64) (int, bool, error) {
+	mask := m.slots - 1
+	free := -1
+	for i, n := int(tag)&mask, 0; n < m.slots; i, n = (i+1)&mask, n+1 {
+		s := m.slot(i)
+		switch t := binary.LittleEndian.Uint64(s); t {
+		case slotEmpty:
+			if free < 0 {
+				free = i
+			}
+			return free, false, nil
+		case slotDeleted:
+			if free < 0 {
+				free = i
+			}
+		case tag:
+			k, _, err := m.entry(s)
+			if err != nil {
+				return 0, false, err
+			}
+			if bytes.Equal(k, key) {
+				return i, true, nil
+			}
+		}
+	}
+	return free, false, nil
+}
+
+func (m *HashMap) checkKV(key, value []byte) error {
+	if m.keySize != HashMapVarSize && len(key) != m.keySize {
+		return fmt.Errorf("HashMap: key size %d, want %d: %w", len(key), m.keySize, ErrInvalid)
+	}
+	if value != nil && m.valueSize != HashMapVarSize && len(value) != m.valueSize {
+		return fmt.Errorf("HashMap: value size %d, want %d: %w", len(value), m.valueSize, ErrInvalid)
+	}
+	return nil
+}
+
+// Get returns the value stored for key. The returned slice points into the
+// mapping and stays valid until the next Put, Delete or Close of m. When
+// another process grows the table, m moves to the new file but keeps the
+// old mapping until Close, so earlier slices stay readable.
+func (m *HashMap) Get(key []byte) ([]byte, bool) {
+	if m == nil {
+		return nil, false
+	}
+	if m.rlock() != nil {
+		return nil, false
+	}
+	defer m.mu.RUnlock()
+
+	if m.file.data == nil || m.checkKV(key, nil) != nil {
+		return nil, false
+	}
+	i, ok, err := m.find(key, hashKey(key))
+	if err != nil || !ok {
+		return nil, false
+	}
+	_, v, err := m.entry(m.slot(i))
+	return v, err == nil
+}
+
+// Put stores value under key, growing the table when it is too full.
+func (m *HashMap) Put(key, value []byte) error {
+	if m == nil {
+		return ErrInvalid
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file.data == nil {
+		return fmt.Errorf("HashMap: %w", ErrClosed)
+	}
+	if !m.file.Writable() {
+		return ErrBadFileDesc
+	}
+	if err := m.follow(); err != nil {
+		return err
+	}
+	if err := m.checkKV(key, value); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+
+	tag := hashKey(key)
+	i, ok, err := m.find(key, tag)
+	if err != nil {
+		return err
+	}
+	if !ok && (i < 0 || (m.count()+m.tombstones()+1)*4 > m.slots*3) {
+		if err := m.grow(len(key) + len(value)); err != nil {
+			return err
+		}
+		if i, ok, err = m.find(key, tag); err != nil {
+			return err
+		}
+	}
+	s := m.slot(i)
+
+	if !m.variable() {
+		copy(s[8:], key)
+		copy(s[8+m.keySize:], value)
+	} else {
+		if ok {
+			_, old, err := m.entry(s)
+			if err != nil {
+				return err
+			}
+			if len(value) <= len(old) {
+				copy(old, value)
+				binary.LittleEndian.PutUint32(s[20:], uint32(len(value)))
+				return nil
+			}
+		}
+		if m.heapEnd()+len(key)+len(value) > len(m.file.data) {
+			if err := m.grow(len(key) + len(value)); err != nil {
+				return err
+			}
+			if i, ok, err = m.find(key, tag); err != nil {
+				return err
+			}
+			s = m.slot(i)
+		}
+		off := m.heapEnd()
+		copy(m.file.data[off:], key)
+		copy(m.file.data[off+len(key):], value)
+		m.setHeader(48, uint64(off+len(key)+len(value)))
+		binary.LittleEndian.PutUint64(s[8:], uint64(off))
+		binary.LittleEndian.PutUint32(s[16:], uint32(len(key)))
+		binary.LittleEndian.PutUint32(s[20:], uint32(len(value)))
+	}
+
+	if !ok {
+		if binary.LittleEndian.Uint64(s) == slotDeleted {
+			m.setHeader(32, uint64(m.tombstones()-1))
+		}
+		m.setHeader(24, uint64(m.count()+1))
+	}
+	binary.LittleEndian.PutUint64(s, tag)
+	return nil
+}
+
+// Delete removes key from the table and reports whether it was present.
+func (m *HashMap) Delete(key []byte) (bool, error) {
+	if m == nil {
+		return false, ErrInvalid
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file.data == nil {
+		return false, fmt.Errorf("HashMap: %w", ErrClosed)
+	}
+	if !m.file.Writable() {
+		return false, ErrBadFileDesc
+	}
+	if err := m.follow(); err != nil {
+		return false, err
+	}
+	if err := m.checkKV(key, nil); err != nil {
+		return false, err
+	}
+	i, ok, err := m.find(key, hashKey(key))
+	if err != nil || !ok {
+		return false, err
+	}
+	binary.LittleEndian.PutUint64(m.slot(i), slotDeleted)
+	m.setHeader(24, uint64(m.count()-1))
+	m.setHeader(32, uint64(m.tombstones()+1))
+	return true, nil
+}
+
+// Range calls fn for every entry until fn returns false. The slices passed
+// to fn point into the mapping and must not be retained after fn returns.
+// It stops at the first corrupt entry.
+func (m *HashMap) Range(fn func(key, value []byte) bool) {
+	if m == nil {
+		return
+	}
+	if m.rlock() != nil {
+		return
+	}
+	defer m.mu.RUnlock()
+
+	if m.file.data == nil {
+		return
+	}
+	m.rangeLocked(fn)
+}
+
+func (m *HashMap) rangeLocked(fn func(key, value []byte) bool) {
+	for i := 0; i < m.slots; i++ {
+		s := m.slot(i)
+		if binary.LittleEndian.Uint64(s) <= slotDeleted {
+			continue
+		}
+		k, v, err := m.entry(s)
+		if err != nil || !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Len returns the number of entries in the table.
+func (m *HashMap) Len() int {
+	if m == nil {
+		return 0
+	}
+	if m.rlock() != nil {
+		return 0
+	}
+	defer m.mu.RUnlock()
+
+	if m.file.data == nil {
+		return 0
+	}
+	return m.count()
+}
+
+// grow rehashes the table into a new file that replaces the current one.
+// extra is the number of heap bytes the caller is about to append.
+func (m *HashMap) grow(extra int) error {
+	live := m.count() + 1
+	slots := m.slots
+	for live*4 > slots*3/2 {
+		slots <<= 1
+	}
+
+	heap := 0
+	if m.variable() {
+		m.rangeLocked(func(key, value []byte) bool {
+			heap += len(key) + len(value)
+			return true
+		})
+		heap = (heap+extra)*2 + pageSize
+	}
+
+	tmp := m.path + ".grow"
+	n, err := createHashMap(tmp, m.keySize, m.valueSize, slots, heap)
+	if err != nil {
+		return err
+	}
+	m.rangeLocked(func(key, value []byte) bool {
+		err = n.Put(key, value)
+		return err == nil
+	})
+	if err == nil {
+		err = n.file.Sync()
+	}
+	if err != nil {
+		_ = n.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if DebugLogEnabled() {
+		Log().Debug("HashMap.grow", "path", m.path, "slots", slots, "heap", heap, "count", n.count())
+	}
+
+	_ = n.Close()
+	if err := os.Rename(tmp, m.path); err != nil {
+		return err
+	}
+	// Tell the processes still mapping the old file to reopen the path.
+	m.setHeader(hashMapMovedOff, m.header(hashMapMovedOff)|hashMapMoved)
+	if err := m.file.Close(); err != nil {
+		return err
+	}
+	f, err := OpenFile(m.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	m.file = f
+	return m.load()
+}
+
+// Sync commits the table to stable storage.
+func (m *HashMap) Sync() error {
+	if m == nil {
+		return ErrInvalid
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.file.Sync()
+}
+
+// Close closes the underlying mapped file, along with the files of the
+// table that m followed after other processes grew it.
+func (m *HashMap) Close() error {
+	if m == nil {
+		return ErrInvalid
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := []error{m.file.Close()}
+	for _, f := range m.followed {
+		errs = append(errs, f.Close())
+	}
+	m.followed = nil
+	return errors.Join(errs...)
+}
+
+// hashKey returns the FNV-1a hash of key, avoiding the reserved slot tags.
+func hashKey(key []byte) uint64 {
+	h := fnv64a(key)
+	if h <= slotDeleted {
+		h += 2
+	}
+	return h
+}
+
+// fnv64a returns the 64-bit FNV-1a hash of b.
+func fnv64a(b []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
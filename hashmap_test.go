@@ -0,0 +1,193 @@
+package mmap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestHashMapFixed(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "fixed.hm")
+	m, err := mmap.CreateHashMap(fname, 8, 8, 4)
+	if err != nil {
+		t.Fatalf("could not create hash map: %+v", err)
+	}
+	defer m.Close()
+
+	const n = 1000
+	key := func(i int) []byte { return binary.LittleEndian.AppendUint64(nil, uint64(i)) }
+	for i := 0; i < n; i++ {
+		if err := m.Put(key(i), key(i*i)); err != nil {
+			t.Fatalf("could not put %d: %+v", i, err)
+		}
+	}
+	if got, want := m.Len(), n; got != want {
+		t.Fatalf("invalid len: got=%d, want=%d", got, want)
+	}
+	for i := 0; i < n; i++ {
+		v, ok := m.Get(key(i))
+		if !ok {
+			t.Fatalf("missing key %d", i)
+		}
+		if got, want := v, key(i*i); !bytes.Equal(got, want) {
+			t.Fatalf("invalid value for %d: got=%v, want=%v", i, got, want)
+		}
+	}
+
+	for i := 0; i < n; i += 2 {
+		ok, err := m.Delete(key(i))
+		if err != nil || !ok {
+			t.Fatalf("could not delete %d: %v %+v", i, ok, err)
+		}
+	}
+	if _, ok := m.Get(key(0)); ok {
+		t.Fatal("deleted key still present")
+	}
+	if got, want := m.Len(), n/2; got != want {
+		t.Fatalf("invalid len: got=%d, want=%d", got, want)
+	}
+
+	if err := m.Put([]byte("short"), key(0)); !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+}
+
+func TestHashMapVariable(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "var.hm")
+	m, err := mmap.CreateHashMap(fname, mmap.HashMapVarSize, mmap.HashMapVarSize, 0)
+	if err != nil {
+		t.Fatalf("could not create hash map: %+v", err)
+	}
+
+	const n = 500
+	for i := 0; i < n; i++ {
+		k, v := fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d-%s", i, bytes.Repeat([]byte{'x'}, i%37))
+		if err := m.Put([]byte(k), []byte(v)); err != nil {
+			t.Fatalf("could not put %q: %+v", k, err)
+		}
+	}
+	if err := m.Put([]byte("key-1"), []byte("v1")); err != nil {
+		t.Fatalf("could not overwrite: %+v", err)
+	}
+	if err := m.Put([]byte("key-2"), bytes.Repeat([]byte{'y'}, 100)); err != nil {
+		t.Fatalf("could not overwrite: %+v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("could not close hash map: %+v", err)
+	}
+
+	r, err := mmap.OpenHashMap(fname, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("could not open hash map: %+v", err)
+	}
+	defer r.Close()
+
+	if got, want := r.Len(), n; got != want {
+		t.Fatalf("invalid len: got=%d, want=%d", got, want)
+	}
+	for i, want := range map[string]string{
+		"key-0":   "value-0-",
+		"key-1":   "v1",
+		"key-2":   string(bytes.Repeat([]byte{'y'}, 100)),
+		"key-499": fmt.Sprintf("value-499-%s", bytes.Repeat([]byte{'x'}, 499%37)),
+	} {
+		v, ok := r.Get([]byte(i))
+		if !ok {
+			t.Fatalf("missing key %q", i)
+		}
+		if got := string(v); got != want {
+			t.Fatalf("invalid value for %q: got=%q, want=%q", i, got, want)
+		}
+	}
+
+	if err := r.Put([]byte("k"), []byte("v")); !errors.Is(err, mmap.ErrBadFileDesc) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+	}
+}
+
+func TestOpenHashMapInvalid(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "invalid.hm")
+	if err := os.WriteFile(fname, bytes.Repeat([]byte{1}, 128), 0o644); err != nil {
+		t.Fatalf("could not seed file: %+v", err)
+	}
+	_, err := mmap.OpenHashMap(fname, os.O_RDONLY)
+	if !errors.Is(err, mmap.ErrInvalidFormat) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalidFormat)
+	}
+}
+
+func TestHashMapGrowShared(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "shared.hm")
+	w, err := mmap.CreateHashMap(fname, mmap.HashMapVarSize, mmap.HashMapVarSize, 0)
+	if err != nil {
+		t.Fatalf("could not create hash map: %+v", err)
+	}
+	defer w.Close()
+	if err := w.Put([]byte("first"), []byte("1")); err != nil {
+		t.Fatalf("could not put: %+v", err)
+	}
+	r, err := mmap.OpenHashMap(fname, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("could not open hash map: %+v", err)
+	}
+	defer r.Close()
+	first, ok := r.Get([]byte("first"))
+	if !ok {
+		t.Fatal("missing first")
+	}
+
+	// Growing replaces the file; the reader follows it to the new one.
+	for i := 0; i < 1000; i++ {
+		if err := w.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")); err != nil {
+			t.Fatalf("could not put: %+v", err)
+		}
+	}
+	if got, want := r.Len(), 1001; got != want {
+		t.Fatalf("invalid len: got=%d, want=%d", got, want)
+	}
+	if v, ok := r.Get([]byte("key-999")); !ok || string(v) != "value" {
+		t.Fatalf("invalid value: %q, %v", v, ok)
+	}
+	// Slices from before the move still point at the old mapping.
+	if got, want := string(first), "1"; got != want {
+		t.Fatalf("invalid value: got=%q, want=%q", got, want)
+	}
+}
+
+func TestHashMapCorruptHeap(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "corrupt.hm")
+	m, err := mmap.CreateHashMap(fname, mmap.HashMapVarSize, mmap.HashMapVarSize, 0)
+	if err != nil {
+		t.Fatalf("could not create hash map: %+v", err)
+	}
+	if err := m.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("could not put: %+v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("could not close hash map: %+v", err)
+	}
+
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("could not read file: %+v", err)
+	}
+	// Point the heap offset of the used slot past the end of the file.
+	for off := 64; off+24 <= len(b); off += 24 {
+		if binary.LittleEndian.Uint64(b[off:]) > 1 {
+			binary.LittleEndian.PutUint64(b[off+8:], 1<<40)
+			break
+		}
+	}
+	if err := os.WriteFile(fname, b, 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	if _, err := mmap.OpenHashMap(fname, os.O_RDONLY); !errors.Is(err, mmap.ErrInvalidFormat) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalidFormat)
+	}
+}
@@ -0,0 +1,135 @@
+package mmap
+
+import (
+	"encoding/binary"
+	"os"
+	"time"
+)
+
+const (
+	segmentMagic      = 0x47534d4d // "MMSG"
+	segmentVersion    = 1
+	segmentHeaderSize = 64
+)
+
+// SegmentHeader describes the payload of a shared memory segment created
+// with WithHeader.
+type SegmentHeader struct {
+	// Type and Version are the application type tag and schema version
+	// given to WithHeader.
+	Type    uint32
+	Version uint32
+	// Size is the payload size in bytes, excluding the header.
+	Size    int
+	Created time.Time
+	// PID is the process that created the segment.
+	PID int
+}
+
+// writeHeader writes h to the start of b.
+//
+//	0  magic           4  header version
+//	8  type           12  version
+//	16 payload size   24  creation time, unix nanoseconds
+//	32 owner pid      56  checksum of bytes 0-55
+func writeHeader(b []byte, h SegmentHeader) {
+	clear(b[:segmentHeaderSize])
+	binary.LittleEndian.PutUint32(b[0:], segmentMagic)
+	binary.LittleEndian.PutUint32(b[4:], segmentVersion)
+	binary.LittleEndian.PutUint32(b[8:], h.Type)
+	binary.LittleEndian.PutUint32(b[12:], h.Version)
+	binary.LittleEndian.PutUint64(b[16:], uint64(h.Size))
+	binary.LittleEndian.PutUint64(b[24:], uint64(h.Created.UnixNano()))
+	binary.LittleEndian.PutUint32(b[32:], uint32(h.PID))
+	binary.LittleEndian.PutUint64(b[56:], fnv64a(b[:56]))
+}
+
+// readHeader reads the header at the start of b. It returns ErrNoHeader
+// when b does not start with one.
+func readHeader(b []byte) (SegmentHeader, error) {
+	if len(b) < segmentHeaderSize || binary.LittleEndian.Uint32(b) != segmentMagic {
+		return SegmentHeader{}, ErrNoHeader
+	}
+	if sum, want := binary.LittleEndian.Uint64(b[56:]), fnv64a(b[:56]); sum != want {
+		return SegmentHeader{}, &HeaderError{Field: "checksum", Got: sum, Want: want}
+	}
+	if v := binary.LittleEndian.Uint32(b[4:]); v != segmentVersion {
+		return SegmentHeader{}, &HeaderError{Field: "header version", Got: uint64(v), Want: segmentVersion}
+	}
+	h := SegmentHeader{
+		Type:    binary.LittleEndian.Uint32(b[8:]),
+		Version: binary.LittleEndian.Uint32(b[12:]),
+		Size:    int(binary.LittleEndian.Uint64(b[16:])),
+		Created: time.Unix(0, int64(binary.LittleEndian.Uint64(b[24:]))),
+		PID:     int(binary.LittleEndian.Uint32(b[32:])),
+	}
+	if h.Size < 0 || h.Size > len(b)-segmentHeaderSize {
+		return SegmentHeader{}, &HeaderError{Field: "size", Got: uint64(h.Size), Want: uint64(len(b) - segmentHeaderSize)}
+	}
+	return h, nil
+}
+
+// headerSize returns the size of the segment to create for a payload of
+// size bytes.
+func (o *options) headerSize(size int) int {
+	if o.header {
+		return size + segmentHeaderSize
+	}
+	return size
+}
+
+// applyHeader writes or validates the segment header of the mapping b and
+// returns the payload and the header. An owner writes a header when asked
+// with WithHeader and returns size bytes of payload. An attacher requires a
+// matching header with WithHeader and otherwise only skips a valid one.
+func applyHeader(b []byte, owner bool, size int, o *options) ([]byte, *SegmentHeader, error) {
+	if owner {
+		if !o.header {
+			return b, nil, nil
+		}
+		if size == 0 {
+			size = len(b) - segmentHeaderSize
+		}
+		h := SegmentHeader{
+			Type:    o.headerType,
+			Version: o.headerVersion,
+			Size:    size,
+			Created: time.Now().Round(0),
+			PID:     os.Getpid(),
+		}
+		writeHeader(b, h)
+		return b[segmentHeaderSize : segmentHeaderSize+size], &h, nil
+	}
+
+	h, err := readHeader(b)
+	if err != nil {
+		if o.header {
+			return nil, nil, err
+		}
+		return b, nil, nil
+	}
+	if o.header {
+		if h.Type != o.headerType {
+			return nil, nil, &HeaderError{Field: "type", Got: uint64(h.Type), Want: uint64(o.headerType)}
+		}
+		if h.Version != o.headerVersion {
+			return nil, nil, &HeaderError{Field: "version", Got: uint64(h.Version), Want: uint64(o.headerVersion)}
+		}
+	}
+	if size > h.Size {
+		return nil, nil, &HeaderError{Field: "size", Got: uint64(h.Size), Want: uint64(size)}
+	}
+	if size == 0 {
+		size = h.Size
+	}
+	return b[segmentHeaderSize : segmentHeaderSize+size], &h, nil
+}
+
+// Header returns the segment header of f, and false when the segment has
+// none.
+func (f *MapMem) Header() (SegmentHeader, bool) {
+	if f.header == nil {
+		return SegmentHeader{}, false
+	}
+	return *f.header, true
+}
@@ -0,0 +1,112 @@
+package mmap_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestSegmentHeader(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(1000), mmap.WithHeader(7, 2))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if got, want := m.Len(), 1000; got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+	h, ok := m.Header()
+	if !ok || h.Type != 7 || h.Version != 2 || h.Size != 1000 || h.PID != os.Getpid() || h.Created.IsZero() {
+		t.Fatalf("invalid header: %+v, %v", h, ok)
+	}
+	if _, err := m.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	if err := m.Advise(mmap.AdviceWillNeed); err != nil {
+		t.Fatalf("could not advise: %+v", err)
+	}
+
+	r, err := mmap.OpenMemS(m.ID())
+	if err != nil {
+		t.Fatalf("could not attach: %+v", err)
+	}
+	defer r.Close()
+	if got, want := r.Len(), 1000; got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+	if got, ok := r.Header(); !ok || got != h {
+		t.Fatalf("invalid header:\ngot= %+v\nwant=%+v", got, h)
+	}
+	buf := make([]byte, 5)
+	if _, err := r.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+		t.Fatalf("invalid read: %q, %+v", buf, err)
+	}
+
+	r2, err := mmap.OpenMemWith(mmap.WithID(m.ID()), mmap.WithHeader(7, 2))
+	if err != nil {
+		t.Fatalf("could not attach: %+v", err)
+	}
+	_ = r2.Close()
+
+	tests := []struct {
+		name  string
+		opts  []mmap.Option
+		field string
+	}{
+		{"type", []mmap.Option{mmap.WithHeader(8, 2)}, "type"},
+		{"version", []mmap.Option{mmap.WithHeader(7, 3)}, "version"},
+		{"size", []mmap.Option{mmap.WithSize(2000)}, "size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mmap.OpenMemWith(append(tt.opts, mmap.WithID(m.ID()))...)
+			var herr *mmap.HeaderError
+			if !errors.As(err, &herr) || herr.Field != tt.field {
+				t.Fatalf("invalid error: %+v", err)
+			}
+			if !errors.Is(err, mmap.ErrInvalidFormat) {
+				t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalidFormat)
+			}
+		})
+	}
+}
+
+func TestSegmentNoHeader(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(4096))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if _, ok := m.Header(); ok {
+		t.Fatal("memory has a header")
+	}
+	_, err = mmap.OpenMemWith(mmap.WithID(m.ID()), mmap.WithHeader(7, 2))
+	if !errors.Is(err, mmap.ErrNoHeader) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrNoHeader)
+	}
+}
+
+func TestSegmentHeaderDefaultSize(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithHeader(7, 2))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if got, want := m.Len(), os.Getpagesize(); got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+	if h, ok := m.Header(); !ok || h.Size != os.Getpagesize() {
+		t.Fatalf("invalid header: %+v, %v", h, ok)
+	}
+
+	r, err := mmap.OpenMemS(m.ID())
+	if err != nil {
+		t.Fatalf("could not attach: %+v", err)
+	}
+	defer r.Close()
+	if got, want := r.Len(), os.Getpagesize(); got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+}
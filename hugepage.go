@@ -0,0 +1,13 @@
+package mmap
+
+// Huge page sizes for WithHugePages.
+const (
+	HugePageDefault = 0
+	HugePage2M      = 2 << 20
+	HugePage1G      = 1 << 30
+)
+
+// roundUp rounds n up to a multiple of align, a power of two.
+func roundUp(n, align int) int {
+	return (n + align - 1) &^ (align - 1)
+}
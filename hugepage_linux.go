@@ -0,0 +1,78 @@
+//go:build linux
+
+package mmap
+
+import (
+	"bufio"
+	"bytes"
+	"math/bits"
+	"os"
+	"strconv"
+	"sync"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+const (
+	shmHugeTLB   = 0o4000
+	shmHugeShift = 26
+)
+
+var defaultHugePageSize = sync.OnceValue(func() int {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return HugePage2M
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		v, ok := bytes.CutPrefix(s.Bytes(), []byte("Hugepagesize:"))
+		if !ok {
+			continue
+		}
+		kb, err := strconv.Atoi(string(bytes.TrimSpace(bytes.TrimSuffix(bytes.TrimSpace(v), []byte("kB")))))
+		if err != nil || kb <= 0 {
+			break
+		}
+		return kb << 10
+	}
+	return HugePage2M
+})
+
+// hugePageSize returns the huge page size in bytes to use for size.
+func hugePageSize(size int) (int, error) {
+	if size == HugePageDefault {
+		return defaultHugePageSize(), nil
+	}
+	if size < os.Getpagesize() || size&(size-1) != 0 {
+		return 0, ErrInvalid
+	}
+	return size, nil
+}
+
+// hugeFlags encodes a huge page size in the way SHM_HUGE_* and MAP_HUGE_*
+// expect it, as its log2 at shift.
+func hugeFlags(size, shift int) int {
+	return bits.TrailingZeros(uint(size)) << shift
+}
+
+// shmHugeFlags returns the shmget flags that request huge pages of size.
+func shmHugeFlags(size int) int {
+	return shmHugeTLB | hugeFlags(size, shmHugeShift)
+}
+
+// mapHugeFlags returns the mmap flags that request huge pages of size.
+func mapHugeFlags(size int) int {
+	return syscall.MAP_HUGETLB | hugeFlags(size, syscall.MAP_HUGE_SHIFT)
+}
+
+// adviseHugePages asks for transparent huge pages on b.
+func adviseHugePages(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	if err := syscall.Madvise(b, syscall.MADV_HUGEPAGE); err != nil {
+		return os.NewSyscallError("madvise", err)
+	}
+	return nil
+}
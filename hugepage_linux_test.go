@@ -0,0 +1,49 @@
+//go:build linux
+
+package mmap_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestHugePages(t *testing.T) {
+	_, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithHugePages(3<<20))
+	if !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+
+	m, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithHugePages(mmap.HugePage2M))
+	if err != nil {
+		t.Skipf("huge pages are not available: %+v", err)
+	}
+	defer m.Close()
+	if got, want := m.Len(), mmap.HugePage2M; got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+	if _, err := m.WriteAt([]byte("hello"), mmap.HugePage2M-5); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+}
+
+func TestTransparentHugePages(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(mmap.HugePage2M), mmap.WithTransparentHugePages())
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+
+	path := filepath.Join(t.TempDir(), "data")
+	f, err := mmap.OpenFileWith(path, mmap.WithFlag(os.O_RDWR), mmap.WithSize(mmap.HugePage2M), mmap.WithTransparentHugePages())
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	if got, want := f.Len(), mmap.HugePage2M; got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !windows
+
+package mmap
+
+// hugePageSize returns the huge page size in bytes to use for size.
+func hugePageSize(size int) (int, error) {
+	return 0, ErrUnsupported
+}
+
+// shmHugeFlags returns the shmget flags that request huge pages of size.
+func shmHugeFlags(size int) int {
+	return 0
+}
+
+// mapHugeFlags returns the mmap flags that request huge pages of size.
+func mapHugeFlags(size int) int {
+	return 0
+}
+
+// adviseHugePages asks for transparent huge pages on b.
+func adviseHugePages(b []byte) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package mmap
+
+import (
+	syscall "golang.org/x/sys/windows"
+)
+
+const (
+	secCommit        = 0x8000000
+	secLargePages    = 0x80000000
+	fileMapLargePage = 0x20000000
+)
+
+// hugePageSize returns the huge page size in bytes to use for size. Windows
+// has a single large page size, so any other size is unsupported.
+func hugePageSize(size int) (int, error) {
+	min := int(syscall.GetLargePageMinimum())
+	if min == 0 {
+		return 0, ErrUnsupported
+	}
+	if size != HugePageDefault && size != min {
+		return 0, ErrUnsupported
+	}
+	return min, nil
+}
+
+// adviseHugePages asks for transparent huge pages on b.
+func adviseHugePages(b []byte) error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package mmap
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// InheritEnv is the environment variable in which AttachToCmd describes the
+// memory handed to a child process. It holds name=kind:handle:size:access
+// entries separated by semicolons.
+const InheritEnv = "MMAP_INHERIT"
+
+// inherited describes memory handed to a child process.
+type inherited struct {
+	// kind is "fd" for a file descriptor, "mem" for a SysV segment id and
+	// "handle" for a Windows file mapping handle.
+	kind     string
+	handle   uintptr
+	size     int
+	writable bool
+}
+
+func (in inherited) String() string {
+	access := "ro"
+	if in.writable {
+		access = "rw"
+	}
+	return fmt.Sprintf("%s:%d:%d:%s", in.kind, in.handle, in.size, access)
+}
+
+func parseInherited(s string) (inherited, error) {
+	var in inherited
+	fields := strings.Split(s, ":")
+	if len(fields) != 4 {
+		return in, ErrInvalidFormat
+	}
+	handle, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return in, ErrInvalidFormat
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil || size <= 0 {
+		return in, ErrInvalidFormat
+	}
+	switch fields[3] {
+	case "rw":
+		in.writable = true
+	case "ro":
+	default:
+		return in, ErrInvalidFormat
+	}
+	in.kind, in.handle, in.size = fields[0], uintptr(handle), size
+	return in, nil
+}
+
+// AttachToCmd hands the memory of f to the process started by cmd. The
+// descriptor or handle is added to cmd and described in its InheritEnv
+// variable under the tag of f, so the child finds it with InheritedMem.
+// It must be called before cmd is started, and f must stay open until then.
+// The child can write to memfd-backed and Windows memory when f can, and
+// to SysV segments when their permissions allow. Anonymous memory returns
+// ErrUnsupported.
+func (f *MapMem) AttachToCmd(cmd *exec.Cmd) error {
+	if f == nil || cmd == nil {
+		return &MapError{Op: "MapMem.AttachToCmd", Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return f.error("AttachToCmd", 0, 0, ErrClosed)
+	}
+	if f.anon {
+		return f.error("AttachToCmd", 0, 0, ErrUnsupported)
+	}
+	in, err := f.attach(cmd)
+	if err != nil {
+		return f.error("AttachToCmd", 0, 0, err)
+	}
+	in.size = len(f.data)
+	setInheritEnv(cmd, f.tag, in)
+	f.logOp(slog.LevelDebug, "AttachToCmd", "tag", f.tag, "inherit", in.String())
+	return nil
+}
+
+// InheritedMem maps the memory named name that the parent process attached
+// with AttachToCmd. It takes ownership of the inherited descriptor or
+// handle, so call it once per name. WithLogger, WithPopulate and
+// WithTransparentHugePages apply.
+func InheritedMem(name string, opts ...Option) (*MapMem, error) {
+	in, err := lookupInherited(os.Getenv(InheritEnv), name)
+	if err != nil {
+		return nil, &MapError{Op: "MapMem.Inherit", Path: name, Err: err}
+	}
+	f, err := openInherited(name, in, newOptions(opts))
+	if err != nil {
+		return nil, &MapError{Op: "MapMem.Inherit", Path: name, Len: in.size, Err: err}
+	}
+	return f, nil
+}
+
+// setInheritEnv adds name=in to the InheritEnv variable of cmd, starting
+// from the environment of the current process when cmd.Env is nil.
+func setInheritEnv(cmd *exec.Cmd, name string, in inherited) {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	entry := url.QueryEscape(name) + "=" + in.String()
+	prefix := InheritEnv + "="
+	for i, kv := range env {
+		if strings.HasPrefix(kv, prefix) {
+			env[i] = kv + ";" + entry
+			cmd.Env = env
+			return
+		}
+	}
+	cmd.Env = append(env, prefix+entry)
+}
+
+// lookupInherited finds name in the value of InheritEnv. The last entry
+// wins when the name was attached more than once.
+func lookupInherited(value, name string) (inherited, error) {
+	var found string
+	for _, entry := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		if k, err := url.QueryUnescape(k); err == nil && k == name {
+			found = v
+		}
+	}
+	if found == "" {
+		return inherited{}, os.ErrNotExist
+	}
+	return parseInherited(found)
+}
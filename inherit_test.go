@@ -0,0 +1,75 @@
+package mmap_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+// TestInheritedMemChild runs in the child process started by
+// TestAttachToCmd.
+func TestInheritedMemChild(t *testing.T) {
+	if os.Getenv("MMAP_TEST_CHILD") == "" {
+		t.Skip("only runs as a child of TestAttachToCmd")
+	}
+	m, err := mmap.InheritedMem("table")
+	if err != nil {
+		t.Fatalf("could not inherit memory: %+v", err)
+	}
+	defer m.Close()
+	if got, want := m.Len(), 4096; got != want {
+		t.Fatalf("invalid len: got=%d, want=%d", got, want)
+	}
+	buf := make([]byte, 5)
+	if _, err := m.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+		t.Fatalf("invalid read: %q, %+v", buf, err)
+	}
+	if m.Writable() {
+		if _, err := m.WriteAt([]byte("world"), 0); err != nil {
+			t.Fatalf("could not write: %+v", err)
+		}
+	}
+	if _, err := mmap.InheritedMem("missing"); err == nil {
+		t.Fatal("inherited memory that was not attached")
+	}
+}
+
+func TestAttachToCmd(t *testing.T) {
+	for name, opt := range map[string]mmap.Option{
+		"shm":    mmap.WithID(mmap.MapMemKeyInvalid),
+		"header": mmap.WithHeader(1, 1),
+		"memfd":  mmap.WithMemfd(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithTag("table"), opt)
+			if errors.Is(err, mmap.ErrUnsupported) {
+				t.Skipf("unsupported: %+v", err)
+			}
+			if err != nil {
+				t.Fatalf("could not create memory: %+v", err)
+			}
+			defer m.Close()
+			if _, err := m.WriteAt([]byte("hello"), 0); err != nil {
+				t.Fatalf("could not write: %+v", err)
+			}
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestInheritedMemChild$", "-test.v")
+			cmd.Env = append(os.Environ(), "MMAP_TEST_CHILD=1")
+			if err := m.AttachToCmd(cmd); err != nil {
+				t.Fatalf("could not attach: %+v", err)
+			}
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("child failed: %+v\n%s", err, out)
+			}
+
+			// The child writes to every kind of memory it may write to.
+			buf := make([]byte, 5)
+			if _, err := m.ReadAt(buf, 0); err != nil || string(buf) != "world" {
+				t.Fatalf("write not visible: %q, %+v", buf, err)
+			}
+		})
+	}
+}
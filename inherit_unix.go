@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd
+
+package mmap
+
+import (
+	"os"
+	"os/exec"
+)
+
+// attach adds the descriptor of f to the ExtraFiles of cmd, or describes
+// the SysV segment of f by its id. The child attaches to a SysV segment
+// like any other process, read-write when its permissions allow.
+func (f *MapMem) attach(cmd *exec.Cmd) (inherited, error) {
+	if f.file == nil {
+		return inherited{kind: "mem", handle: uintptr(f.id)}, nil
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f.file)
+	// ExtraFiles start after stdin, stdout and stderr in the child.
+	fd := 2 + len(cmd.ExtraFiles)
+	return inherited{kind: "fd", handle: uintptr(fd), writable: f.writable}, nil
+}
+
+func openInherited(name string, in inherited, o *options) (*MapMem, error) {
+	switch in.kind {
+	case "mem":
+		o.id, o.size, o.tag = int(in.handle), in.size, name
+		return openMapMem(o)
+	case "fd":
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	start := now()
+	file := os.NewFile(in.handle, name)
+	if file == nil {
+		return nil, ErrBadFileDesc
+	}
+	if fi, err := file.Stat(); err != nil || fi.Size() < int64(in.size) {
+		_ = file.Close()
+		return nil, ErrInvalid
+	}
+	f, err := mapFdMem(file, in.size, in.writable, name, o)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	f.observe(EventOpen, start, 0, 0, nil)
+	return f, nil
+}
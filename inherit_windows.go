@@ -0,0 +1,84 @@
+package mmap
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// attach adds the inheritable file mapping handle of f to the handles the
+// child of cmd inherits.
+func (f *MapMem) attach(cmd *exec.Cmd) (inherited, error) {
+	if f.handle == 0 {
+		return inherited{}, ErrUnsupported
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.AdditionalInheritedHandles = append(cmd.SysProcAttr.AdditionalInheritedHandles, syscall.Handle(f.handle))
+	return inherited{kind: "handle", handle: f.handle, writable: f.writable}, nil
+}
+
+func openInherited(name string, in inherited, o *options) (*MapMem, error) {
+	if in.kind != "handle" {
+		return nil, ErrInvalidFormat
+	}
+	start := now()
+	access := uint32(windows.FILE_MAP_READ)
+	prot := PROT_READ
+	if in.writable {
+		access = windows.FILE_MAP_WRITE
+		prot |= PROT_WRITE
+	}
+	// Map the whole memory, which may start with a segment header.
+	handle := windows.Handle(in.handle)
+	data, err := mapView(handle, access, 0)
+	if err != nil {
+		_ = windows.CloseHandle(handle)
+		return nil, err
+	}
+	payload, header, err := applyHeader(data, false, in.size, o)
+	if err == nil && header == nil {
+		if in.size > len(data) {
+			err = ErrInvalid
+		} else {
+			payload = data[:in.size]
+		}
+	}
+	if err != nil {
+		_ = unmapView(data)
+		_ = windows.CloseHandle(handle)
+		return nil, err
+	}
+
+	f := &MapMem{
+		owner:    in.writable,
+		writable: in.writable,
+		data:     payload,
+		handle:   in.handle,
+		tag:      name,
+		header:   header,
+		close:    closeHandle(in.handle),
+		unmap:    unmapView,
+		logger:   o.logger,
+	}
+	if header != nil {
+		f.base = data
+	}
+	f.reg = mappings.add(MappingInfo{
+		Kind:  "mem",
+		Path:  name,
+		Size:  in.size,
+		Prot:  prot,
+		Owner: in.writable,
+	})
+	if o.populate {
+		_ = prefault(context.Background(), f.data, nil)
+	}
+	runtime.SetFinalizer(f, finalizeMapMem)
+	f.observe(EventOpen, start, 0, 0, nil)
+	return f, nil
+}
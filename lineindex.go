@@ -0,0 +1,234 @@
+package mmap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+const (
+	lineIndexMagic      = 0x494c4d4d // "MMLI"
+	lineIndexVersion    = 1
+	lineIndexHeaderSize = 32
+)
+
+// LineIndex is a table of the line offsets of a mapped text file, giving
+// random access to its lines. Lines end with "\n"; the last line may lack
+// one.
+type LineIndex struct {
+	f *MapFile
+	// ends holds the offset just past the end of every line.
+	ends []int64
+}
+
+// NewLineIndex indexes the lines of f, scanning it in parallel with
+// workers goroutines as Scan does.
+func NewLineIndex(ctx context.Context, f *MapFile, workers int) (*LineIndex, error) {
+	var (
+		mu     sync.Mutex
+		chunks = make(map[int64][]int64)
+	)
+	err := f.Scan(ctx, DefaultScanChunk, workers, func(off int64, chunk []byte) error {
+		var ends []int64
+		for i := 0; ; {
+			j := bytes.IndexByte(chunk[i:], '\n')
+			if j < 0 {
+				break
+			}
+			i += j + 1
+			ends = append(ends, off+int64(i))
+		}
+		mu.Lock()
+		chunks[off] = ends
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	offs := make([]int64, 0, len(chunks))
+	n := 0
+	for off, ends := range chunks {
+		offs = append(offs, off)
+		n += len(ends)
+	}
+	slices.Sort(offs)
+	x := &LineIndex{f: f, ends: make([]int64, 0, n+1)}
+	for _, off := range offs {
+		x.ends = append(x.ends, chunks[off]...)
+	}
+	if size := int64(len(f.data)); size > 0 && (len(x.ends) == 0 || x.ends[len(x.ends)-1] != size) {
+		x.ends = append(x.ends, size)
+	}
+	return x, nil
+}
+
+// LoadLineIndex loads the index of f saved by Save at path. It returns
+// ErrInvalidFormat when the index does not belong to f as it is now, after
+// the file was changed.
+func LoadLineIndex(f *MapFile, path string) (*LineIndex, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < lineIndexHeaderSize ||
+		binary.LittleEndian.Uint32(b[0:]) != lineIndexMagic ||
+		binary.LittleEndian.Uint32(b[4:]) != lineIndexVersion {
+		return nil, fmt.Errorf("LineIndex: %q: %w", path, ErrInvalidFormat)
+	}
+	size, mtime, err := f.indexStamp()
+	if err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint64(b[24:])
+	if binary.LittleEndian.Uint64(b[8:]) != uint64(size) ||
+		binary.LittleEndian.Uint64(b[16:]) != uint64(mtime) ||
+		n != uint64(len(b)-lineIndexHeaderSize)/8 {
+		return nil, fmt.Errorf("LineIndex: %q: stale index: %w", path, ErrInvalidFormat)
+	}
+	x := &LineIndex{f: f, ends: make([]int64, n)}
+	var last int64
+	for i := range x.ends {
+		end := int64(binary.LittleEndian.Uint64(b[lineIndexHeaderSize+8*i:]))
+		if end < last || end > size {
+			return nil, fmt.Errorf("LineIndex: %q: %w", path, ErrInvalidFormat)
+		}
+		x.ends[i], last = end, end
+	}
+	if last != size {
+		return nil, fmt.Errorf("LineIndex: %q: %w", path, ErrInvalidFormat)
+	}
+	return x, nil
+}
+
+// Save writes the index to a sidecar file at path, to be loaded by
+// LoadLineIndex. The file records the size and modification time of the
+// indexed file to detect a stale index.
+func (x *LineIndex) Save(path string) error {
+	size, mtime, err := x.f.indexStamp()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	var h [lineIndexHeaderSize]byte
+	binary.LittleEndian.PutUint32(h[0:], lineIndexMagic)
+	binary.LittleEndian.PutUint32(h[4:], lineIndexVersion)
+	binary.LittleEndian.PutUint64(h[8:], uint64(size))
+	binary.LittleEndian.PutUint64(h[16:], uint64(mtime))
+	binary.LittleEndian.PutUint64(h[24:], uint64(len(x.ends)))
+	_, _ = w.Write(h[:])
+	var b [8]byte
+	for _, end := range x.ends {
+		binary.LittleEndian.PutUint64(b[:], uint64(end))
+		_, _ = w.Write(b[:])
+	}
+	if err := w.Flush(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// indexStamp returns the size of the mapping of f and the modification time
+// of its file, which identify the content a LineIndex was built from.
+func (f *MapFile) indexStamp() (int64, int64, error) {
+	if f.data == nil {
+		return 0, 0, &MapError{Op: "LineIndex", Path: f.path, Err: ErrClosed}
+	}
+	fi, err := f.fd.Stat()
+	if err != nil {
+		return 0, 0, &MapError{Op: "LineIndex", Path: f.path, Err: underlyingError(err)}
+	}
+	return int64(len(f.data)), fi.ModTime().UnixNano(), nil
+}
+
+// NumLines returns the number of lines.
+func (x *LineIndex) NumLines() int {
+	return len(x.ends)
+}
+
+// Line returns line i, counted from zero, without its "\n" or "\r\n"
+// terminator. The slice aliases the mapping and must not be modified or
+// used after the file is closed. It returns ErrTruncated when the file was
+// remapped shorter than the line since the index was built.
+func (x *LineIndex) Line(i int) ([]byte, error) {
+	if i < 0 || i >= len(x.ends) {
+		return nil, &MapError{Op: "LineIndex.Line", Path: x.f.path, Err: ErrInvalid}
+	}
+	if x.f.data == nil {
+		return nil, &MapError{Op: "LineIndex.Line", Path: x.f.path, Err: ErrClosed}
+	}
+	var start int64
+	if i > 0 {
+		start = x.ends[i-1]
+	}
+	if x.ends[i] > int64(len(x.f.data)) {
+		return nil, &MapError{Op: "LineIndex.Line", Path: x.f.path, Offset: start, Err: ErrTruncated}
+	}
+	return dropEOL(x.f.data[start:x.ends[i]]), nil
+}
+
+// Offset returns the offset of line i in the mapping, or the end of the
+// mapping when i is NumLines or more.
+func (x *LineIndex) Offset(i int) int64 {
+	if i <= 0 || len(x.ends) == 0 {
+		return 0
+	}
+	return x.ends[min(i, len(x.ends))-1]
+}
+
+func dropEOL(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+// Scanner returns a LineScanner over the lines from line i on.
+func (x *LineIndex) Scanner(i int) *LineScanner {
+	return &LineScanner{x: x, next: max(i, 0)}
+}
+
+// LineScanner iterates over the lines of a LineIndex with the methods of
+// bufio.Scanner, returning slices of the mapping without copying them.
+type LineScanner struct {
+	x    *LineIndex
+	next int
+	line []byte
+	err  error
+}
+
+// Scan advances to the next line, and reports false at the end of the
+// lines or on an error.
+func (s *LineScanner) Scan() bool {
+	if s.err != nil || s.next >= s.x.NumLines() {
+		s.line = nil
+		return false
+	}
+	s.line, s.err = s.x.Line(s.next)
+	s.next++
+	return s.err == nil
+}
+
+// Bytes returns the current line. It aliases the mapping.
+func (s *LineScanner) Bytes() []byte {
+	return s.line
+}
+
+// Text returns a copy of the current line.
+func (s *LineScanner) Text() string {
+	return string(s.line)
+}
+
+// Err returns the error that stopped the scan, if any.
+func (s *LineScanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,149 @@
+package mmap_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/godcong/mmap"
+)
+
+func TestLineIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+	var content bytes.Buffer
+	for i := range 100000 {
+		fmt.Fprintf(&content, "%d,value %d\r\n", i, i*i)
+	}
+	content.WriteString("last")
+	if err := os.WriteFile(path, content.Bytes(), 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+
+	x, err := mmap.NewLineIndex(context.Background(), f, 4)
+	if err != nil {
+		t.Fatalf("could not index: %+v", err)
+	}
+	if got, want := x.NumLines(), 100001; got != want {
+		t.Fatalf("invalid line count: got=%d, want=%d", got, want)
+	}
+	for _, i := range []int{0, 1, 4097, 99999} {
+		line, err := x.Line(i)
+		if want := fmt.Sprintf("%d,value %d", i, i*i); err != nil || string(line) != want {
+			t.Fatalf("invalid line %d: got=%q, want=%q, %+v", i, line, want, err)
+		}
+	}
+	if line, _ := x.Line(100000); string(line) != "last" {
+		t.Fatalf("invalid last line: %q", line)
+	}
+	if _, err := x.Line(100001); !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+
+	// The scanner returns what bufio.Scanner does.
+	want := bufio.NewScanner(bytes.NewReader(content.Bytes()))
+	got := x.Scanner(0)
+	for want.Scan() {
+		if !got.Scan() || !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Fatalf("invalid line: got=%q, want=%q", got.Bytes(), want.Bytes())
+		}
+	}
+	if got.Scan() || got.Err() != nil {
+		t.Fatalf("scanner did not stop: %+v", got.Err())
+	}
+
+	sidecar := path + ".idx"
+	if err := x.Save(sidecar); err != nil {
+		t.Fatalf("could not save: %+v", err)
+	}
+	y, err := mmap.LoadLineIndex(f, sidecar)
+	if err != nil {
+		t.Fatalf("could not load: %+v", err)
+	}
+	if line, _ := y.Line(4097); string(line) != "4097,value 16785409" {
+		t.Fatalf("invalid line: %q", line)
+	}
+
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("could not touch file: %+v", err)
+	}
+	if _, err := mmap.LoadLineIndex(f, sidecar); !errors.Is(err, mmap.ErrInvalidFormat) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalidFormat)
+	}
+}
+
+func TestLineIndexEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	x, err := mmap.NewLineIndex(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("could not index: %+v", err)
+	}
+	if got := x.NumLines(); got != 0 {
+		t.Fatalf("invalid line count: got=%d, want=0", got)
+	}
+	for _, i := range []int{0, 1, 10} {
+		if got := x.Offset(i); got != 0 {
+			t.Fatalf("invalid offset of line %d: got=%d, want=0", i, got)
+		}
+	}
+	if x.Scanner(0).Scan() {
+		t.Fatal("scanned a line of an empty file")
+	}
+}
+
+func TestLineIndexTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	content := bytes.Repeat([]byte("0123456789\n"), 1000)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+	x, err := mmap.NewLineIndex(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("could not index: %+v", err)
+	}
+
+	if err := os.Truncate(path, 100); err != nil {
+		t.Fatalf("could not truncate: %+v", err)
+	}
+	if err := f.Refresh(); err != nil {
+		t.Fatalf("could not refresh: %+v", err)
+	}
+	if line, err := x.Line(2); err != nil || string(line) != "0123456789" {
+		t.Fatalf("invalid line: %q, %+v", line, err)
+	}
+	if _, err := x.Line(546); !errors.Is(err, mmap.ErrTruncated) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrTruncated)
+	}
+
+	sidecar := path + ".idx"
+	if err := x.Save(sidecar); err != nil {
+		t.Fatalf("could not save: %+v", err)
+	}
+	if _, err := mmap.LoadLineIndex(f, sidecar); !errors.Is(err, mmap.ErrInvalidFormat) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalidFormat)
+	}
+}
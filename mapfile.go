@@ -1,11 +1,13 @@
 package mmap
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"io"
+	"log/slog"
 	"os"
 	"runtime"
+	"sync/atomic"
+	"time"
 )
 
 // MapFile reads/writes a memory-mapped file.
@@ -13,8 +15,23 @@ type MapFile struct {
 	data     []byte
 	off      int
 	writable bool
-
-	fd *os.File
+	guarded  bool
+	prot     int
+	flags    int
+	offset   int64
+	sync     SyncPolicy
+	thp      bool
+
+	fd     *os.File
+	path   string
+	reg    uint64
+	logger *slog.Logger
+	// written counts the bytes written since the last sync or close event.
+	written uint64
+	// stale is set by Watch when the file changed size since it was mapped.
+	stale atomic.Bool
+	// closing is closed by Close to end the watches of the file.
+	closing chan struct{}
 	// fileSize int64
 }
 
@@ -23,35 +40,103 @@ func (f *MapFile) Len() int {
 	return len(f.data)
 }
 
-// At returns the byte at index i.
+// Bytes returns the mapped memory. The slice aliases the mapping and must
+// not be used after Close. Accesses through it are not covered by guarded
+// mode and crash the program when the file was truncated; View is the
+// guarded way to access the mapping without copying.
+func (f *MapFile) Bytes() []byte {
+	return f.data
+}
+
+// At returns the byte at index i. Having no error result, it panics with
+// a *MapError on a fault caught in guarded mode, which the caller may
+// recover; ReadAt and View return the error instead.
 func (f *MapFile) At(i int) byte {
-	return f.data[i]
+	if err := f.refreshStale("At"); err != nil {
+		panic(err)
+	}
+	var v byte
+	if err := f.guard("At", int64(i), 1, func() { v = f.data[i] }); err != nil {
+		panic(err)
+	}
+	return v
 }
 
 // Stat returns the MapFileInfo structure describing file.
-// If there is an error, it will be of type *os.PathError.
+// If there is an error, it will be of type *MapError.
 func (f *MapFile) Stat() (os.FileInfo, error) {
 	if f == nil {
-		return nil, ErrInvalid
+		return nil, &MapError{Op: "MapFile.Stat", Err: ErrInvalid}
 	}
 
-	return f.fd.Stat()
+	fi, err := f.fd.Stat()
+	if err != nil {
+		return nil, f.error("Stat", 0, 0, err)
+	}
+	return fi, nil
 }
 
 func (f *MapFile) Writable() bool {
 	return f.writable
 }
 
+// SetLogger sets the logger used for messages about f. A nil logger falls
+// back to Log.
+func (f *MapFile) SetLogger(l *slog.Logger) {
+	f.logger = l
+}
+
+func (f *MapFile) log() *slog.Logger {
+	if f.logger != nil {
+		return f.logger
+	}
+	return Log()
+}
+
+// logOp logs a message about op on f at level, tagged with the path of f.
+func (f *MapFile) logOp(level slog.Level, op string, args ...any) {
+	l := f.log()
+	if !logEnabled(l, level) {
+		return
+	}
+	l.Log(context.Background(), level, "MapFile."+op, append([]any{"op", op, "path", f.path}, args...)...)
+}
+
+// error wraps err into a *MapError describing the operation on f.
+func (f *MapFile) error(op string, off int64, n int, err error) error {
+	return &MapError{Op: "MapFile." + op, Path: f.path, Offset: off, Len: n, Err: err}
+}
+
+// syncWrite flushes the n bytes written at off when f syncs every write.
+func (f *MapFile) syncWrite(op string, off, n int) error {
+	if f.sync != SyncAlways || n == 0 || f.flags&MAP_PRIVATE != 0 {
+		return nil
+	}
+	if err := f.flush(off, n); err != nil {
+		return f.error(op, int64(off), n, err)
+	}
+	return nil
+}
+
 // Read implements the io.Reader interface.
 func (f *MapFile) Read(p []byte) (int, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapFile.Read", Err: ErrInvalid}
 	}
 
+	if f.data == nil {
+		return 0, f.error("Read", int64(f.off), len(p), ErrClosed)
+	}
+	if err := f.refreshStale("Read"); err != nil {
+		return 0, err
+	}
 	if f.off >= len(f.data) {
 		return 0, EOF
 	}
-	n := copy(p, f.data[f.off:])
+	var n int
+	if err := f.guard("Read", int64(f.off), len(p), func() { n = copy(p, f.data[f.off:]) }); err != nil {
+		return 0, err
+	}
 	f.off += n
 	return n, nil
 }
@@ -59,13 +144,22 @@ func (f *MapFile) Read(p []byte) (int, error) {
 // ReadByte implements the io.ByteReader interface.
 func (f *MapFile) ReadByte() (byte, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapFile.ReadByte", Err: ErrInvalid}
 	}
 
+	if f.data == nil {
+		return 0, f.error("ReadByte", int64(f.off), 1, ErrClosed)
+	}
+	if err := f.refreshStale("ReadByte"); err != nil {
+		return 0, err
+	}
 	if f.off >= len(f.data) {
 		return 0, EOF
 	}
-	v := f.data[f.off]
+	var v byte
+	if err := f.guard("ReadByte", int64(f.off), 1, func() { v = f.data[f.off] }); err != nil {
+		return 0, err
+	}
 	f.off++
 	return v, nil
 }
@@ -73,16 +167,22 @@ func (f *MapFile) ReadByte() (byte, error) {
 // ReadAt implements the io.ReaderAt interface.
 func (f *MapFile) ReadAt(p []byte, off int64) (int, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapFile.ReadAt", Err: ErrInvalid}
 	}
 
 	if f.data == nil {
-		return 0, errors.New("MapFile: closed")
+		return 0, f.error("ReadAt", off, len(p), ErrClosed)
+	}
+	if err := f.refreshStale("ReadAt"); err != nil {
+		return 0, err
 	}
 	if off < 0 || int64(len(f.data)) < off {
-		return 0, fmt.Errorf("MapFile: invalid ReadAt offset %d", off)
+		return 0, f.error("ReadAt", off, len(p), ErrInvalid)
+	}
+	var n int
+	if err := f.guard("ReadAt", off, len(p), func() { n = copy(p, f.data[off:]) }); err != nil {
+		return 0, err
 	}
-	n := copy(p, f.data[off:])
 	if n < len(p) {
 		return n, io.EOF
 	}
@@ -92,25 +192,38 @@ func (f *MapFile) ReadAt(p []byte, off int64) (int, error) {
 // Write implements the io.Writer interface.
 func (f *MapFile) Write(p []byte) (int, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapFile.Write", Err: ErrInvalid}
 	}
 
 	if !f.Writable() {
-		return 0, ErrBadFileDesc
+		return 0, f.error("Write", int64(f.off), len(p), ErrBadFileDesc)
+	}
+	if f.data == nil {
+		return 0, f.error("Write", int64(f.off), len(p), ErrClosed)
+	}
+	if err := f.refreshStale("Write"); err != nil {
+		return 0, err
 	}
 	if f.off >= len(f.data) {
-
-		Log().Error("MapFile.Write error", "err", ErrShortWrite, "len", len(f.data), "off", f.off)
-
-		return 0, ErrShortWrite
+		err := f.error("Write", int64(f.off), len(p), ErrShortWrite)
+		f.logOp(slog.LevelError, "Write", "err", err, "len", len(f.data), "off", f.off)
+		f.observe(EventShortWrite, time.Time{}, int64(f.off), len(p), err)
+		return 0, err
+	}
+	var n int
+	if err := f.guard("Write", int64(f.off), len(p), func() { n = copy(f.data[f.off:], p) }); err != nil {
+		return 0, err
 	}
-	n := copy(f.data[f.off:], p)
 	f.off += n
+	f.written += uint64(n)
+	if err := f.syncWrite("Write", f.off-n, n); err != nil {
+		return n, err
+	}
 	if len(p) > n {
-
-		Log().Error("MapFile.Write written error", "err", ErrShortWrite, "len", len(f.data), "off", f.off)
-
-		return n, ErrShortWrite
+		err := f.error("Write", int64(f.off-n), len(p), ErrShortWrite)
+		f.logOp(slog.LevelError, "Write", "err", err, "len", len(f.data), "off", f.off)
+		f.observe(EventShortWrite, time.Time{}, int64(f.off-n), len(p), err)
+		return n, err
 	}
 	return n, nil
 }
@@ -118,66 +231,91 @@ func (f *MapFile) Write(p []byte) (int, error) {
 // WriteByte implements the io.ByteWriter interface.
 func (f *MapFile) WriteByte(c byte) error {
 	if f == nil {
-		return ErrInvalid
+		return &MapError{Op: "MapFile.WriteByte", Err: ErrInvalid}
 	}
 
 	if !f.Writable() {
-		return ErrBadFileDesc
+		return f.error("WriteByte", int64(f.off), 1, ErrBadFileDesc)
+	}
+	if f.data == nil {
+		return f.error("WriteByte", int64(f.off), 1, ErrClosed)
+	}
+	if err := f.refreshStale("WriteByte"); err != nil {
+		return err
 	}
 	if f.off >= len(f.data) {
-
-		Log().Error("MapFile.WriteByte", "err", ErrShortWrite, "len", len(f.data), "off", f.off)
-
-		return ErrShortWrite
+		err := f.error("WriteByte", int64(f.off), 1, ErrShortWrite)
+		f.logOp(slog.LevelError, "WriteByte", "err", err, "len", len(f.data), "off", f.off)
+		f.observe(EventShortWrite, time.Time{}, int64(f.off), 1, err)
+		return err
+	}
+	if err := f.guard("WriteByte", int64(f.off), 1, func() { f.data[f.off] = c }); err != nil {
+		return err
 	}
-	f.data[f.off] = c
 	f.off++
-	return nil
+	f.written++
+	return f.syncWrite("WriteByte", f.off-1, 1)
 }
 
 // WriteAt implements the io.WriterAt interface.
 func (f *MapFile) WriteAt(p []byte, off int64) (int, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapFile.WriteAt", Err: ErrInvalid}
 	}
 
 	if !f.Writable() {
-		return 0, ErrBadFileDesc
+		return 0, f.error("WriteAt", off, len(p), ErrBadFileDesc)
 	}
 	if f.data == nil {
-		return 0, errors.New("MapFile: closed")
+		return 0, f.error("WriteAt", off, len(p), ErrClosed)
+	}
+	if err := f.refreshStale("WriteAt"); err != nil {
+		return 0, err
 	}
 	if off < 0 || int64(len(f.data)) < off {
-		return 0, fmt.Errorf("MapFile: invalid WriteAt offset %d", off)
+		return 0, f.error("WriteAt", off, len(p), ErrInvalid)
+	}
+	var n int
+	if err := f.guard("WriteAt", off, len(p), func() { n = copy(f.data[off:], p) }); err != nil {
+		return 0, err
+	}
+	f.written += uint64(n)
+	if err := f.syncWrite("WriteAt", int(off), n); err != nil {
+		return n, err
 	}
-	n := copy(f.data[off:], p)
 	if n < len(p) {
-
-		Log().Error("MapFile.WriteByte error", "err", ErrShortWrite, "len", len(f.data), "off", f.off)
-
-		return n, ErrShortWrite
+		err := f.error("WriteAt", off, len(p), ErrShortWrite)
+		f.logOp(slog.LevelError, "WriteAt", "err", err, "len", len(f.data), "off", off)
+		f.observe(EventShortWrite, time.Time{}, off, len(p), err)
+		return n, err
 	}
 	return n, nil
 }
 
+// Seek implements the io.Seeker interface.
 func (f *MapFile) Seek(offset int64, whence int) (int64, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapFile.Seek", Err: ErrInvalid}
 	}
 
+	if f.data == nil {
+		return 0, f.error("Seek", offset, 0, ErrClosed)
+	}
+	off := f.off
 	switch whence {
 	case io.SeekStart:
-		f.off = int(offset)
+		off = int(offset)
 	case io.SeekCurrent:
-		f.off += int(offset)
+		off += int(offset)
 	case io.SeekEnd:
-		f.off = len(f.data) - int(offset)
+		off = len(f.data) - int(offset)
 	default:
-		return 0, fmt.Errorf("MapFile: invalid whence")
+		return 0, f.error("Seek", offset, 0, ErrInvalid)
 	}
-	if f.off < 0 {
-		return 0, fmt.Errorf("MapFile: negative position")
+	if off < 0 {
+		return 0, f.error("Seek", offset, 0, ErrInvalid)
 	}
+	f.off = off
 	return int64(f.off), nil
 }
 
@@ -185,42 +323,71 @@ func (f *MapFile) Fd() uintptr {
 	return f.fd.Fd()
 }
 
-// Open memory-maps the named file for reading.
+// Open memory-maps the named file for reading. A missing file is created
+// empty with no permissions, as it always has been.
 func Open(filename string) (*MapFile, error) {
-	return openMapFile(filename, os.O_RDONLY, 0, 0)
+	return OpenFileWith(filename, WithPerm(0))
 }
 
 // OpenFile memory-maps the named file for reading/writing, depending on
 // the flag value.
 func OpenFile(filename string, flag int, mode os.FileMode) (*MapFile, error) {
-	return openMapFile(filename, flag, mode, 0)
+	return OpenFileWith(filename, WithFlag(flag), WithPerm(mode))
 }
 
 // OpenFileS memory-maps the named file for reading/writing, depending on
-// the flag value.
+// the flag value. A writable file shorter than size is extended to size
+// before it is mapped; longer files are never shrunk. Earlier versions
+// ignored size for existing files.
 func OpenFileS(filename string, flag int, mode os.FileMode, size int) (*MapFile, error) {
-	return openMapFile(filename, flag, mode, size)
+	return OpenFileWith(filename, WithFlag(flag), WithPerm(mode), WithSize(size))
+}
+
+// openExisting memory-maps the named file for reading like Open, but fails
+// with an error matching fs.ErrNotExist instead of creating a missing file.
+func openExisting(filename string) (*MapFile, error) {
+	o := newOptions(nil)
+	o.noCreate = true
+	return openMapFile(filename, o)
 }
 
-func openMapFile(filename string, mode int, perm os.FileMode, size int) (*MapFile, error) {
+// OpenFileWith memory-maps the named file as configured by opts. Without
+// options the file is mapped read-only, like Open.
+func OpenFileWith(filename string, opts ...Option) (*MapFile, error) {
+	return openMapFile(filename, newOptions(opts))
+}
+
+func openMapFile(filename string, o *options) (*MapFile, error) {
 	if len(filename) == 0 {
-		return nil, ENOENT
+		return nil, &MapError{Op: "MapFile.Open", Err: ENOENT}
 	}
+	if o.offset < 0 || o.offset%offsetAlignment() != 0 {
+		return nil, &MapError{Op: "MapFile.Open", Path: filename, Offset: o.offset, Err: ErrInvalid}
+	}
+	start := now()
 
-	f, err := os.OpenFile(filename, mode|os.O_CREATE, perm)
+	flag := o.flag
+	if !o.noCreate {
+		flag |= os.O_CREATE
+	}
+	f, err := os.OpenFile(filename, flag, o.perm)
 	if err != nil {
-		return nil, err
+		return nil, &MapError{Op: "MapFile.Open", Path: filename, Err: underlyingError(err)}
+	}
+	fail := func(err error) (*MapFile, error) {
+		_ = f.Close()
+		return nil, &MapError{Op: "MapFile.Open", Path: filename, Offset: o.offset, Len: o.size, Err: underlyingError(err)}
 	}
 
 	fi, err := f.Stat()
 	if err != nil {
-		return nil, err
+		return fail(err)
 	}
 
 	fsize := fi.Size()
 	prot := PROT_READ
 	writable := false
-	switch mode & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	switch o.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
 	case os.O_WRONLY:
 		writable = true
 		prot = PROT_WRITE
@@ -229,30 +396,82 @@ func openMapFile(filename string, mode int, perm os.FileMode, size int) (*MapFil
 		prot = PROT_READ | PROT_WRITE
 	default:
 	}
+	flags := MAP_SHARED
+	if o.private {
+		flags = MAP_PRIVATE
+		prot |= PROT_READ | PROT_WRITE
+	}
+	if o.prot != 0 {
+		prot = o.prot
+	}
+	if o.populate {
+		flags |= mapPopulate
+	}
 
-	if fsize == 0 && !writable {
-		Log().Warn("MapFile.Open as read only", "size", size)
-		return &MapFile{writable: writable}, nil
+	if writable && o.offset+int64(o.size) > fsize {
+		if err := f.Truncate(o.offset + int64(o.size)); err != nil {
+			return fail(err)
+		}
+		fsize = o.offset + int64(o.size)
 	}
-	if fsize < 0 {
-		return nil, fmt.Errorf("MapFile: file %q has negative size", filename)
+	// A private mapping is writable whatever the file was opened with.
+	writable = prot&PROT_WRITE != 0
+
+	length := fsize - o.offset
+	if length <= 0 && !writable {
+		o.log().Warn("MapFile.Open as read only", "op", "Open", "path", filename, "size", o.size)
+		return &MapFile{
+			data:     []byte{},
+			fd:       f,
+			path:     filename,
+			writable: writable,
+			prot:     prot,
+			flags:    flags,
+			offset:   o.offset,
+			sync:     o.sync,
+			thp:      o.thp,
+			logger:   o.logger,
+		}, nil
 	}
-	if fsize != int64(int(fsize)) {
-		return nil, fmt.Errorf("MapFile: file %q is too large", filename)
+	if length < 0 || length != int64(int(length)) {
+		return fail(ErrInvalid)
 	}
 
-	data, err := Mmap(int(f.Fd()), 0, int(fsize), prot, MAP_SHARED)
+	data, err := Mmap(int(f.Fd()), o.offset, int(length), prot, flags)
 	if err != nil {
-		Log().Error("MapFile.Open error", "err", err, "size", size, "datalen", len(data), "cap", cap(data))
-		return nil, err
+		o.log().Error("MapFile.Open", "op", "Open", "path", filename, "err", err, "size", length)
+		return fail(err)
+	}
+	if o.thp {
+		if err := adviseHugePages(data); err != nil {
+			o.log().Warn("MapFile.Open", "op", "Open", "path", filename, "err", err)
+		}
+	}
+	if o.populate && mapPopulate == 0 {
+		_ = prefault(context.Background(), data, nil)
 	}
 
 	fd := &MapFile{
 		data:     data,
 		fd:       f,
+		path:     filename,
 		writable: writable,
-	}
-	runtime.SetFinalizer(fd, (*MapFile).Close)
+		prot:     prot,
+		flags:    flags,
+		offset:   o.offset,
+		sync:     o.sync,
+		thp:      o.thp,
+		logger:   o.logger,
+	}
+	fd.reg = mappings.add(MappingInfo{
+		Kind:  "file",
+		Path:  filename,
+		Size:  len(data),
+		Prot:  prot,
+		Owner: writable,
+	})
+	runtime.SetFinalizer(fd, finalizeMapFile)
+	fd.observe(EventOpen, start, 0, 0, nil)
 	return fd, nil
 }
 
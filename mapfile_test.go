@@ -2,6 +2,7 @@ package mmap_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
@@ -150,7 +151,7 @@ func TestOpen(t *testing.T) {
 				if err == nil {
 					t.Fatal("expected an error")
 				}
-				if got, want := err, mmap.ErrBadFileDesc; got.Error() != want.Error() {
+				if got, want := err, mmap.ErrBadFileDesc; !errors.Is(got, want) {
 					t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", got, want)
 				}
 			})
@@ -160,7 +161,7 @@ func TestOpen(t *testing.T) {
 				if err == nil {
 					t.Fatal("expected an error")
 				}
-				if got, want := err, mmap.ErrBadFileDesc; got.Error() != want.Error() {
+				if got, want := err, mmap.ErrBadFileDesc; !errors.Is(got, want) {
 					t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", got, want)
 				}
 			})
@@ -170,7 +171,7 @@ func TestOpen(t *testing.T) {
 				if err == nil {
 					t.Fatal("expected an error")
 				}
-				if got, want := err, mmap.ErrBadFileDesc; got.Error() != want.Error() {
+				if got, want := err, mmap.ErrBadFileDesc; !errors.Is(got, want) {
 					t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", got, want)
 				}
 			})
@@ -180,7 +181,7 @@ func TestOpen(t *testing.T) {
 				if err == nil {
 					t.Fatal("expected an error")
 				}
-				if got, want := err, mmap.ErrBadFileDesc; got.Error() != want.Error() {
+				if got, want := err, mmap.ErrBadFileDesc; !errors.Is(got, want) {
 					t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", got, want)
 				}
 			})
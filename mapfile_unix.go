@@ -3,7 +3,7 @@
 package mmap
 
 import (
-	"fmt"
+	"os"
 	"runtime"
 
 	syscall "golang.org/x/sys/unix"
@@ -12,13 +12,21 @@ import (
 // Sync commits the current contents of the file to stable storage.
 func (f *MapFile) Sync() error {
 	if !f.writable {
-		return ErrBadFileDesc
+		return f.error("Sync", 0, len(f.data), ErrBadFileDesc)
 	}
+	if f.data == nil {
+		return f.error("Sync", 0, 0, ErrClosed)
+	}
+	if f.flags&MAP_PRIVATE != 0 {
+		return nil
+	}
+	start := now()
 	err := syscall.Msync(f.data, syscall.MS_SYNC)
 	if err != nil {
-		return fmt.Errorf("MapFile: could not sync: %w", err)
+		err = f.error("Sync", 0, len(f.data), os.NewSyscallError("msync", err))
 	}
-	return nil
+	f.observe(EventSync, start, 0, 0, err)
+	return err
 }
 
 // Close closes the memory-mapped file.
@@ -26,12 +34,36 @@ func (f *MapFile) Close() error {
 	if f.data == nil {
 		return nil
 	}
-	_ = f.Sync()
+	f.stopWatches()
+	if len(f.data) == 0 {
+		f.data = nil
+		runtime.SetFinalizer(f, nil)
+		mappings.remove(f.reg)
+		return f.fd.Close()
+	}
+	start := now()
+	if f.writable && f.sync != SyncNever {
+		_ = f.Sync()
+	}
 
 	defer f.fd.Close()
 
-	data := f.data
-	f.data = nil
 	runtime.SetFinalizer(f, nil)
-	return Munmap(data)
+	mappings.remove(f.reg)
+	err := Munmap(f.data)
+	if err != nil {
+		err = f.error("Close", 0, len(f.data), os.NewSyscallError("munmap", err))
+	}
+	f.observe(EventClose, start, 0, 0, err)
+	f.data = nil
+	return err
+}
+
+// flush writes the pages holding the n bytes at off back to the file.
+func (f *MapFile) flush(off, n int) error {
+	start := off &^ (pageSize - 1)
+	if err := syscall.Msync(f.data[start:off+n], syscall.MS_SYNC); err != nil {
+		return os.NewSyscallError("msync", err)
+	}
+	return nil
 }
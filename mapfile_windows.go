@@ -12,10 +12,22 @@ import (
 // Sync commits the current contents of the file to stable storage.
 func (f *MapFile) Sync() error {
 	if !f.writable {
-		return ErrBadFileDesc
+		return f.error("Sync", 0, len(f.data), ErrBadFileDesc)
+	}
+	if f.data == nil {
+		return f.error("Sync", 0, 0, ErrClosed)
+	}
+	if f.flags&MAP_PRIVATE != 0 {
+		return nil
 	}
 
-	return Flush(f.data, uintptr(len(f.data)))
+	start := now()
+	err := Flush(f.data, uintptr(len(f.data)))
+	if err != nil {
+		err = f.error("Sync", 0, len(f.data), err)
+	}
+	f.observe(EventSync, start, 0, 0, err)
+	return err
 }
 
 // Close closes the reader.
@@ -23,14 +35,29 @@ func (f *MapFile) Close() error {
 	if f.data == nil {
 		return nil
 	}
+	f.stopWatches()
+	if len(f.data) == 0 {
+		f.data = nil
+		runtime.SetFinalizer(f, nil)
+		mappings.remove(f.reg)
+		return f.fd.Close()
+	}
+	start := now()
 	defer f.fd.Close()
 	// Sync the file before closing it.
-	_ = f.Sync()
+	if f.writable && f.sync != SyncNever {
+		_ = f.Sync()
+	}
 
-	data := f.data
-	f.data = nil
 	runtime.SetFinalizer(f, nil)
-	return Munmap(data)
+	mappings.remove(f.reg)
+	err := Munmap(f.data)
+	if err != nil {
+		err = f.error("Close", 0, len(f.data), err)
+	}
+	f.observe(EventClose, start, 0, 0, err)
+	f.data = nil
+	return err
 }
 
 // closeMapFile closes the mapped file.
@@ -43,5 +70,11 @@ func closeMapFile(f *MapFile) error {
 	addr := unsafex.BytesToPtr(f.data)
 	f.data = nil
 	runtime.SetFinalizer(f, nil)
+	mappings.remove(f.reg)
 	return syscall.UnmapViewOfFile(addr)
 }
+
+// flush writes the pages holding the n bytes at off back to the file.
+func (f *MapFile) flush(off, n int) error {
+	return Flush(f.data[off:off+n], uintptr(n))
+}
@@ -1,9 +1,11 @@
 package mmap
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"log/slog"
 	"os"
+	"time"
 )
 
 const (
@@ -17,6 +19,25 @@ type MapMem struct {
 	data  []byte
 	off   int
 	close func() error
+	unmap func(b []byte) error
+	anon  bool
+	// file backs memfd and received memory, nil for SysV segments.
+	file *os.File
+	// handle is the Windows file mapping handle, zero elsewhere.
+	handle uintptr
+	tag    string
+	// base is the whole mapping when data skips a segment header, nil
+	// otherwise.
+	base   []byte
+	header *SegmentHeader
+	reg    uint64
+	logger *slog.Logger
+	// written counts the bytes written since the last sync or close event.
+	written uint64
+
+	// writable is set when the mapping may be written, which owners and
+	// processes attached with write access can.
+	writable bool
 }
 
 var pageSize int
@@ -25,83 +46,135 @@ func init() {
 	pageSize = os.Getpagesize()
 }
 
+// SetLogger sets the logger used for messages about f. A nil logger falls
+// back to Log.
+func (f *MapMem) SetLogger(l *slog.Logger) {
+	f.logger = l
+}
+
+func (f *MapMem) log() *slog.Logger {
+	if f.logger != nil {
+		return f.logger
+	}
+	return Log()
+}
+
+func (f *MapMem) debug() bool {
+	return logEnabled(f.log(), slog.LevelDebug)
+}
+
+// logOp logs a message about op on f at level, tagged with the id of f.
+func (f *MapMem) logOp(level slog.Level, op string, args ...any) {
+	l := f.log()
+	if !logEnabled(l, level) {
+		return
+	}
+	l.Log(context.Background(), level, "MapMem."+op, append([]any{"op", op, "id", f.id}, args...)...)
+}
+
+// error wraps err into a *MapError describing the operation on f.
+func (f *MapMem) error(op string, off int64, n int, err error) error {
+	return &MapError{Op: "MapMem." + op, ID: f.id, Offset: off, Len: n, Err: err}
+}
+
+// Seek implements the io.Seeker interface.
 func (f *MapMem) Seek(offset int64, whence int) (int64, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapMem.Seek", Err: ErrInvalid}
 	}
 
+	if f.data == nil {
+		return 0, f.error("Seek", offset, 0, ErrClosed)
+	}
+	off := f.off
 	switch whence {
 	case io.SeekStart:
-		f.off = int(offset)
+		off = int(offset)
 	case io.SeekCurrent:
-		f.off += int(offset)
+		off += int(offset)
 	case io.SeekEnd:
-		f.off = len(f.data) - int(offset)
+		off = len(f.data) - int(offset)
 	default:
-		return 0, fmt.Errorf("MapMem: invalid whence")
+		return 0, f.error("Seek", offset, 0, ErrInvalid)
 	}
-	if f.off < 0 {
-		return 0, fmt.Errorf("MapMem: negative position")
+	if off < 0 {
+		return 0, f.error("Seek", offset, 0, ErrInvalid)
 	}
-	if DebugLogEnabled() {
-		Log().Debug("MapMem.Seek", "len", len(f.data), "offset", f.off)
+	f.off = off
+	if f.debug() {
+		f.logOp(slog.LevelDebug, "Seek", "len", len(f.data), "offset", f.off)
 	}
 	return int64(f.off), nil
 }
 
+// WriteByte implements the io.ByteWriter interface.
 func (f *MapMem) WriteByte(c byte) error {
 	if f == nil {
-		return ErrInvalid
+		return &MapError{Op: "MapMem.WriteByte", Err: ErrInvalid}
 	}
 
-	if !f.owner {
-		return ErrBadFileDesc
+	if !f.writable {
+		return f.error("WriteByte", int64(f.off), 1, ErrBadFileDesc)
+	}
+	if f.data == nil {
+		return f.error("WriteByte", int64(f.off), 1, ErrClosed)
 	}
 	if f.off >= len(f.data) {
-		if DebugLogEnabled() {
-			Log().Error("MapMem.WriteByte error", "err", ErrShortWrite, "len", len(f.data), "offset", f.off)
+		err := f.error("WriteByte", int64(f.off), 1, ErrShortWrite)
+		if f.debug() {
+			f.logOp(slog.LevelError, "WriteByte", "err", err, "len", len(f.data), "offset", f.off)
 		}
-		return ErrShortWrite
+		f.observe(EventShortWrite, time.Time{}, int64(f.off), 1, err)
+		return err
 	}
 
 	f.data[f.off] = c
 	f.off++
+	f.written++
 	return nil
 }
 
+// WriteAt implements the io.WriterAt interface.
 func (f *MapMem) WriteAt(p []byte, off int64) (n int, err error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapMem.WriteAt", Err: ErrInvalid}
 	}
 
-	if !f.owner {
-		return 0, ErrBadFileDesc
+	if !f.writable {
+		return 0, f.error("WriteAt", off, len(p), ErrBadFileDesc)
 	}
 	if f.data == nil {
-		return 0, fmt.Errorf("MapMem: %w", ErrClosed)
+		return 0, f.error("WriteAt", off, len(p), ErrClosed)
 	}
 	if off < 0 || int64(len(f.data)) < off {
-		err := fmt.Errorf("MapMem: invalid WriteAt offset %d", off)
-		if DebugLogEnabled() {
-			Log().Error("MapMem.WriteAt error", "err", err, "len", len(f.data), "offset", off)
+		err := f.error("WriteAt", off, len(p), ErrInvalid)
+		if f.debug() {
+			f.logOp(slog.LevelError, "WriteAt", "err", err, "len", len(f.data), "offset", off)
 		}
 		return 0, err
 	}
 	n = copy(f.data[off:], p)
+	f.written += uint64(n)
 	if n < len(p) {
-		if DebugLogEnabled() {
-			Log().Error("MapMem.WriteAt error", "err", ErrShortWrite, "len", len(f.data), "written", n)
+		err := f.error("WriteAt", off, len(p), ErrShortWrite)
+		if f.debug() {
+			f.logOp(slog.LevelError, "WriteAt", "err", err, "len", len(f.data), "written", n)
 		}
-		return n, ErrShortWrite
+		f.observe(EventShortWrite, time.Time{}, off, len(p), err)
+		return n, err
 	}
 	return n, nil
 }
 
+// ReadByte implements the io.ByteReader interface.
 func (f *MapMem) ReadByte() (byte, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapMem.ReadByte", Err: ErrInvalid}
 	}
 
+	if f.data == nil {
+		return 0, f.error("ReadByte", int64(f.off), 1, ErrClosed)
+	}
 	if f.off >= len(f.data) {
 		return 0, EOF
 	}
@@ -110,18 +183,19 @@ func (f *MapMem) ReadByte() (byte, error) {
 	return v, nil
 }
 
+// ReadAt implements the io.ReaderAt interface.
 func (f *MapMem) ReadAt(p []byte, off int64) (n int, err error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapMem.ReadAt", Err: ErrInvalid}
 	}
 
 	if f.data == nil {
-		return 0, fmt.Errorf("MapMem: %v", ErrClosed)
+		return 0, f.error("ReadAt", off, len(p), ErrClosed)
 	}
 	if off < 0 || int64(len(f.data)) < off {
-		err := fmt.Errorf("MapMem: invalid ReadAt offset %d", off)
-		if DebugLogEnabled() {
-			Log().Error("MapMem.ReadAt error", "err", err, "len", len(f.data), "offset", off)
+		err := f.error("ReadAt", off, len(p), ErrInvalid)
+		if f.debug() {
+			f.logOp(slog.LevelError, "ReadAt", "err", err, "len", len(f.data), "offset", off)
 		}
 		return 0, err
 	}
@@ -135,9 +209,12 @@ func (f *MapMem) ReadAt(p []byte, off int64) (n int, err error) {
 // Read implements the io.Reader interface.
 func (f *MapMem) Read(p []byte) (int, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapMem.Read", Err: ErrInvalid}
 	}
 
+	if f.data == nil {
+		return 0, f.error("Read", int64(f.off), len(p), ErrClosed)
+	}
 	if f.off >= len(f.data) {
 		return 0, EOF
 	}
@@ -149,29 +226,62 @@ func (f *MapMem) Read(p []byte) (int, error) {
 // Write implements the io.Writer interface.
 func (f *MapMem) Write(p []byte) (int, error) {
 	if f == nil {
-		return 0, ErrInvalid
+		return 0, &MapError{Op: "MapMem.Write", Err: ErrInvalid}
 	}
 
-	if !f.owner {
-		return 0, ErrBadFileDesc
+	if !f.writable {
+		return 0, f.error("Write", int64(f.off), len(p), ErrBadFileDesc)
+	}
+	if f.data == nil {
+		return 0, f.error("Write", int64(f.off), len(p), ErrClosed)
 	}
 	if f.off >= len(f.data) {
-		if DebugLogEnabled() {
-			Log().Error("MapMem.Write error", "err", ErrShortWrite, "len", len(f.data), "offset", f.off)
+		err := f.error("Write", int64(f.off), len(p), ErrShortWrite)
+		if f.debug() {
+			f.logOp(slog.LevelError, "Write", "err", err, "len", len(f.data), "offset", f.off)
 		}
-		return 0, ErrShortWrite
+		f.observe(EventShortWrite, time.Time{}, int64(f.off), len(p), err)
+		return 0, err
 	}
 	n := copy(f.data[f.off:], p)
 	f.off += n
+	f.written += uint64(n)
 	if len(p) > n {
-		if DebugLogEnabled() {
-			Log().Error("MapMem.Write written error", "err", ErrShortWrite, "len", len(f.data), "written", n)
+		err := f.error("Write", int64(f.off-n), len(p), ErrShortWrite)
+		if f.debug() {
+			f.logOp(slog.LevelError, "Write", "err", err, "len", len(f.data), "written", n)
 		}
-		return n, ErrShortWrite
+		f.observe(EventShortWrite, time.Time{}, int64(f.off-n), len(p), err)
+		return n, err
 	}
 	return n, nil
 }
 
+// Tag returns the tag set with WithTag, or received along with the memory
+// by ReceiveMem.
+func (f *MapMem) Tag() string {
+	return f.tag
+}
+
+// mapping returns the whole mapping of f, including its segment header.
+func (f *MapMem) mapping() []byte {
+	if f.base != nil {
+		return f.base
+	}
+	return f.data
+}
+
+// kind names the kind of mapping of f in the registry and in events.
+func (f *MapMem) kind() string {
+	switch {
+	case f.anon:
+		return "anon"
+	case f.file != nil:
+		return "fd"
+	}
+	return "mem"
+}
+
 func (f *MapMem) ID() int {
 	return f.id
 }
@@ -180,6 +290,12 @@ func (f *MapMem) IsOwner() bool {
 	return f.owner
 }
 
+// Writable reports whether f may be written. Processes that attach to a
+// segment they may not write map it read-only.
+func (f *MapMem) Writable() bool {
+	return f.writable
+}
+
 func (f *MapMem) Len() int {
 	return len(f.data)
 }
@@ -188,12 +304,36 @@ func (f *MapMem) Cap() int {
 	return cap(f.data)
 }
 
+// Bytes returns the mapped memory. The slice aliases the mapping and must
+// not be used after Close.
+func (f *MapMem) Bytes() []byte {
+	return f.data
+}
+
+// OpenMem creates a shared memory segment of size bytes when id is
+// MapMemKeyInvalid, or attaches to the first size bytes of segment id.
 func OpenMem(id int, size int) (*MapMem, error) {
-	return openMapMem(id, size)
+	return OpenMemWith(WithID(id), WithSize(size))
 }
 
+// OpenMemS attaches to the whole shared memory segment id, or creates a
+// segment of one page when id is MapMemKeyInvalid. A valid segment header
+// is skipped and reported by Header; use WithHeader to require one.
 func OpenMemS(id int) (*MapMem, error) {
-	return openMapMem(id, 0)
+	return OpenMemWith(WithID(id))
+}
+
+// OpenMemWith creates or attaches to a shared memory segment as configured
+// by opts. Without WithID a new segment is created. Only WithID, WithSize,
+// WithLogger, WithPopulate, the huge page options, WithMemfd, WithTag,
+// WithHeader, WithAutoRemove, WithPerm, WithOwner and
+// WithSecurityDescriptor apply to shared memory.
+func OpenMemWith(opts ...Option) (*MapMem, error) {
+	o := newOptions(opts)
+	if o.memfd {
+		return openMemfd(o)
+	}
+	return openMapMem(o)
 }
 
 func getPageSize(size int) int {
@@ -101,6 +101,40 @@ func TestMemFileWrite(t *testing.T) {
 	}
 }
 
+func TestMemAttachWrite(t *testing.T) {
+	w, err := mmap.OpenMem(mmap.MapMemKeyInvalid, 4096)
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer w.Close()
+	r, err := mmap.OpenMemS(w.ID())
+	if err != nil {
+		t.Fatalf("could not attach: %+v", err)
+	}
+	defer r.Close()
+	if r.IsOwner() || !r.Writable() {
+		t.Fatalf("invalid attach: owner=%v, writable=%v", r.IsOwner(), r.Writable())
+	}
+
+	if _, err := r.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatalf("could not write-at: %+v", err)
+	}
+	if got, want := w.Bytes()[:5], []byte("hello"); !bytes.Equal(got, want) {
+		t.Fatalf("invalid content:\ngot= %q\nwant=%q\n", got, want)
+	}
+	rb, err := mmap.NewBitmap(r)
+	if err != nil {
+		t.Fatalf("could not create bitmap: %+v", err)
+	}
+	wb, err := mmap.NewBitmap(w)
+	if err != nil {
+		t.Fatalf("could not create bitmap: %+v", err)
+	}
+	if rb.TestAndSet(100) || !wb.Test(100) {
+		t.Fatal("bit not shared")
+	}
+}
+
 func TestPointToBytes(t *testing.T) {
 	data := []byte(`hello`)
 	type args struct {
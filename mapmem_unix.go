@@ -3,57 +3,158 @@
 package mmap
 
 import (
+	"context"
 	"os"
 	"runtime"
 
 	syscall "golang.org/x/sys/unix"
 )
 
-func openMapMem(id int, size int) (*MapMem, error) {
+func openMapMem(o *options) (*MapMem, error) {
+	id, size := o.id, o.size
 	var err error
+	start := now()
 	owner := false
 	closer := func() error { return nil }
-	size = getPageSize(size)
 	if id == MapMemKeyInvalid {
 		owner = true
 	}
 	if owner {
-		k := GenKey()
-		id, err = syscall.SysvShmGet(k, size, syscall.IPC_CREAT|syscall.IPC_EXCL|0o600)
+		size = o.headerSize(getPageSize(size))
+		flags := syscall.IPC_CREAT | syscall.IPC_EXCL | int(o.segmentPerm())
+		if o.huge {
+			hsize, err := hugePageSize(o.hugeSize)
+			if err != nil {
+				return nil, &MapError{Op: "MapMem.Open", Len: size, Err: err}
+			}
+			size = roundUp(size, hsize)
+			flags |= shmHugeFlags(hsize)
+		}
+		k := shmKey()
+		id, err = syscall.SysvShmGet(k, size, flags)
+		for i := 1; err == syscall.EEXIST && i < shmKeyTries; i++ {
+			k = shmKey()
+			id, err = syscall.SysvShmGet(k, size, flags)
+		}
 		if err != nil {
-			return nil, os.NewSyscallError("SysvShmGet", err)
+			return nil, &MapError{Op: "MapMem.Open", Len: size, Err: permissionError(os.NewSyscallError("SysvShmGet", err), "")}
+		}
+		if o.uid != -1 || o.gid != -1 {
+			if err := chownShm(id, o.uid, o.gid); err != nil {
+				_ = closeShm(id)()
+				return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
+			}
 		}
 
-		Log().Info("OpenMapMem with owner", "new_id", id, "key", k, "size", size)
+		o.log().Info("MapMem.Open", "op", "Open", "id", id, "key", k, "size", size, "owner", true)
 
 		closer = closeShm(id)
 	} else {
-		Log().Info("OpenMapMem with friendly", "id", id, "size", size)
+		o.log().Info("MapMem.Open", "op", "Open", "id", id, "size", size, "owner", false)
 	}
 
-	data, err := syscall.SysvShmAttach(id, 0, 0)
+	// Attach read-write, and read-only when the permissions of the segment
+	// grant no more.
+	attach := 0
+	data, err := syscall.SysvShmAttach(id, 0, attach)
+	if err == syscall.EACCES && !owner {
+		attach = syscall.SHM_RDONLY
+		data, err = syscall.SysvShmAttach(id, 0, attach)
+	}
 	if err != nil {
-		return nil, os.NewSyscallError("SysvShmAttach", err)
+		_ = closer()
+		err = permissionError(os.NewSyscallError("SysvShmAttach", err), "attaching requires read access to the segment")
+		return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
+	}
+	if owner && o.autoRemove {
+		if err := closer(); err != nil {
+			_ = syscall.SysvShmDetach(data)
+			return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
+		}
+		closer = dummyCloser
+	}
+
+	payload, header, err := applyHeader(data, owner, o.size, o)
+	if err != nil {
+		_ = syscall.SysvShmDetach(data)
+		return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
+	}
+	if header == nil {
+		if size == 0 {
+			size = len(data)
+		}
+		if size > len(data) {
+			_ = syscall.SysvShmDetach(data)
+			return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: ErrInvalid}
+		}
+		payload = data[:size]
+	}
+	size = len(payload)
+
+	if o.thp {
+		if err := adviseHugePages(data); err != nil {
+			o.log().Warn("MapMem.Open", "op", "Open", "id", id, "err", err)
+		}
 	}
 
 	fd := &MapMem{
-		id:    id,
-		owner: owner,
-		data:  data[:size],
-		close: closer,
+		id:       id,
+		owner:    owner,
+		writable: attach&syscall.SHM_RDONLY == 0,
+		data:     payload,
+		tag:      o.tag,
+		header:   header,
+		close:    closer,
+		unmap:    detachShm,
+		logger:   o.logger,
+	}
+	prot := PROT_READ
+	if fd.writable {
+		prot |= PROT_WRITE
+	}
+	if header != nil {
+		fd.base = data
 	}
-	runtime.SetFinalizer(fd, (*MapMem).Close)
+	fd.reg = mappings.add(MappingInfo{
+		Kind:  "mem",
+		ID:    id,
+		Size:  size,
+		Prot:  prot,
+		Owner: owner,
+	})
+	if o.populate {
+		_ = prefault(context.Background(), fd.data, nil)
+	}
+	runtime.SetFinalizer(fd, finalizeMapMem)
+	fd.observe(EventOpen, start, 0, 0, nil)
 	return fd, nil
 }
 
 func (f *MapMem) Close() (err error) {
-	err = syscall.SysvShmDetach(f.data)
+	if f.data == nil {
+		return nil
+	}
+	start := now()
+	err = f.unmap(f.mapping())
 	if err != nil {
-		return os.NewSyscallError("SysvShmDetach", err)
+		return f.error("Close", 0, len(f.data), err)
 	}
 
+	runtime.SetFinalizer(f, nil)
+	mappings.remove(f.reg)
+	if err = f.close(); err != nil {
+		err = f.error("Close", 0, 0, err)
+	}
+	f.observe(EventClose, start, 0, 0, err)
 	f.data = nil
-	return f.close()
+	return err
+}
+
+func detachShm(b []byte) error {
+	if err := syscall.SysvShmDetach(b); err != nil {
+		return os.NewSyscallError("SysvShmDetach", err)
+	}
+	return nil
 }
 
 func closeShm(id int) func() error {
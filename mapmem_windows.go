@@ -1,15 +1,19 @@
 package mmap
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
+	"unsafe"
 
 	"github.com/godcong/mmap/unsafex"
 	syscall "golang.org/x/sys/windows"
 )
 
-func openMapMem(id int, size int) (*MapMem, error) {
+func openMapMem(o *options) (*MapMem, error) {
+	id, size := o.id, o.size
+	start := now()
 	owner := false
 	if id == MapMemKeyInvalid {
 		owner = true
@@ -22,65 +26,178 @@ func openMapMem(id int, size int) (*MapMem, error) {
 	flProtect := syscall.PAGE_READONLY
 	dwDesiredAccess := syscall.FILE_MAP_READ
 
-	size = getPageSize(size)
 	if owner {
+		size = o.headerSize(getPageSize(size))
 		flProtect = syscall.PAGE_READWRITE
 		dwDesiredAccess = syscall.FILE_MAP_WRITE
+		if o.huge {
+			hsize, err := hugePageSize(o.hugeSize)
+			if err != nil {
+				return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
+			}
+			size = roundUp(size, hsize)
+			flProtect |= secCommit | secLargePages
+			dwDesiredAccess |= fileMapLargePage
+		}
+		sa := makeInheritSa()
+		if o.sddl != "" {
+			sd, err := syscall.SecurityDescriptorFromString(o.sddl)
+			if err != nil {
+				return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: fmt.Errorf("%w: security descriptor: %v", ErrInvalid, err)}
+			}
+			sa.SecurityDescriptor = sd
+		}
 		low, high := uint32(size), uint32(size>>32)
-		handle, err = syscall.CreateFileMapping(syscall.InvalidHandle, makeInheritSa(), uint32(flProtect), high, low, wname)
+		handle, err = syscall.CreateFileMapping(syscall.InvalidHandle, sa, uint32(flProtect), high, low, wname)
 		if err != nil {
-			return nil, os.NewSyscallError("CreateFileMapping", err)
+			err = permissionError(os.NewSyscallError("CreateFileMapping", err), "")
+			return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
 		}
 		// }
 	} else {
+		// Attach read-write like the owner, and read-only when the
+		// security descriptor grants no more.
+		dwDesiredAccess = syscall.FILE_MAP_WRITE
 		handle, err = syscallOpenFileMapping(uint32(dwDesiredAccess), true, wname)
+		if err == syscall.ERROR_ACCESS_DENIED {
+			dwDesiredAccess = syscall.FILE_MAP_READ
+			handle, err = syscallOpenFileMapping(uint32(dwDesiredAccess), true, wname)
+		}
 		if err != nil {
-			return nil, err
+			err = permissionError(os.NewSyscallError("OpenFileMapping", err), "the security descriptor of the memory denies read access")
+			return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
 		}
 	}
 
 	// fileOffsetHigh := uint32(0 >> 32)
 	// fileOffsetLow := uint32(0 & 0xFFFFFFFF)
-	mapview, errno := syscall.MapViewOfFile(handle, uint32(dwDesiredAccess), 0, 0, uintptr(size))
-	if errno != nil {
-		return nil, os.NewSyscallError("MapViewOfFile", errno)
+	// An attacher maps the whole segment, which may start with a header.
+	view := size
+	if !owner {
+		view = 0
+	}
+	data, err := mapView(handle, uint32(dwDesiredAccess), view)
+	if err != nil {
+		_ = syscall.CloseHandle(handle)
+		return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
+	}
+
+	payload, header, err := applyHeader(data, owner, o.size, o)
+	if err != nil {
+		_ = unmapView(data)
+		_ = syscall.CloseHandle(handle)
+		return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: err}
 	}
+	if header == nil {
+		if size == 0 {
+			size = len(data)
+		}
+		if size > len(data) {
+			_ = unmapView(data)
+			_ = syscall.CloseHandle(handle)
+			return nil, &MapError{Op: "MapMem.Open", ID: id, Len: size, Err: ErrInvalid}
+		}
+		payload = data[:size]
+	}
+	size = len(payload)
 
 	fd := &MapMem{
-		owner: owner,
-		id:    id,
-		data:  unsafex.PtrToBytes(mapview, size),
-		close: dummyCloser,
+		owner:    owner,
+		writable: dwDesiredAccess&syscall.FILE_MAP_WRITE != 0,
+		id:       id,
+		data:     payload,
+		handle:   uintptr(handle),
+		tag:      o.tag,
+		header:   header,
+		close:    closeHandle(uintptr(handle)),
+		unmap:    unmapView,
+		logger:   o.logger,
+	}
+	prot := PROT_READ
+	if fd.writable {
+		prot |= PROT_WRITE
+	}
+	if header != nil {
+		fd.base = data
 	}
-	runtime.SetFinalizer(fd, (*MapMem).Close)
+	fd.reg = mappings.add(MappingInfo{
+		Kind:  "mem",
+		ID:    id,
+		Size:  size,
+		Prot:  prot,
+		Owner: owner,
+	})
+	if o.populate {
+		_ = prefault(context.Background(), fd.data, nil)
+	}
+	runtime.SetFinalizer(fd, finalizeMapMem)
+	fd.observe(EventOpen, start, 0, 0, nil)
 	return fd, nil
 }
 
 func (f *MapMem) Sync() error {
-	if !f.owner {
-		return ErrBadFileDesc
+	if !f.writable {
+		return f.error("Sync", 0, len(f.data), ErrBadFileDesc)
 	}
-
-	errno := syscall.FlushViewOfFile(unsafex.BytesToPtr(f.data), uintptr(len(f.data)))
-	if errno != nil {
-		return os.NewSyscallError("FlushViewOfFile", errno)
+	if f.data == nil {
+		return f.error("Sync", 0, 0, ErrClosed)
+	}
+	if f.anon {
+		return nil
 	}
 
-	return nil
+	start := now()
+	err := syscall.FlushViewOfFile(unsafex.BytesToPtr(f.data), uintptr(len(f.data)))
+	if err != nil {
+		err = f.error("Sync", 0, len(f.data), os.NewSyscallError("FlushViewOfFile", err))
+	}
+	f.observe(EventSync, start, 0, 0, err)
+	return err
 }
 
 func (f *MapMem) Close() (err error) {
 	if f.data == nil {
 		return nil
 	}
-	_ = f.Sync()
+	start := now()
+	if f.writable {
+		_ = f.Sync()
+	}
 
-	addr := unsafex.BytesToPtr(f.data)
-	f.data = nil
 	runtime.SetFinalizer(f, nil)
-	err = syscall.UnmapViewOfFile(addr)
+	mappings.remove(f.reg)
+	err = f.unmap(f.mapping())
 	if err != nil {
-		return err
+		err = f.error("Close", 0, 0, err)
+	} else if err = f.close(); err != nil {
+		err = f.error("Close", 0, 0, err)
 	}
-	return f.close()
+	f.observe(EventClose, start, 0, 0, err)
+	f.data = nil
+	return err
+}
+
+// mapView maps size bytes of the file mapping handle, or all of it when size
+// is zero.
+func mapView(handle Handle, access uint32, size int) ([]byte, error) {
+	addr, err := syscall.MapViewOfFile(handle, access, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+	if size == 0 {
+		var info syscall.MemoryBasicInformation
+		if err := syscall.VirtualQuery(addr, &info, unsafe.Sizeof(info)); err != nil {
+			_ = syscall.UnmapViewOfFile(addr)
+			return nil, os.NewSyscallError("VirtualQuery", err)
+		}
+		size = int(info.RegionSize)
+	}
+	return unsafex.PtrToBytes(addr, size), nil
+}
+
+func unmapView(b []byte) error {
+	if err := syscall.UnmapViewOfFile(unsafex.BytesToPtr(b)); err != nil {
+		return os.NewSyscallError("UnmapViewOfFile", err)
+	}
+	return nil
 }
@@ -0,0 +1,16 @@
+package mmap
+
+import (
+	"os"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+// newMemfd creates an anonymous file with memfd_create.
+func newMemfd(name string) (*os.File, error) {
+	fd, err := syscall.MemfdCreate("mmap:"+name, syscall.MFD_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("memfd_create", err)
+	}
+	return os.NewFile(uintptr(fd), "memfd:"+name), nil
+}
@@ -0,0 +1,21 @@
+//go:build darwin || freebsd
+
+package mmap
+
+import (
+	"os"
+)
+
+// newMemfd creates an anonymous file by unlinking a temporary file, as
+// memfd_create is not available.
+func newMemfd(name string) (*os.File, error) {
+	f, err := os.CreateTemp("", "mmap-memfd-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,143 @@
+package mmap
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// ExpvarObserver is an Observer that publishes counters through expvar.
+//
+// The published map holds one counter per EventOp, the number of errors,
+// the total and maximum sync latency in nanoseconds, and bytes_written, a
+// map of the bytes written per mapping keyed by path or "<kind>:<id>".
+type ExpvarObserver struct {
+	vars    *expvar.Map
+	written *expvar.Map
+
+	mu      sync.Mutex
+	syncMax *expvar.Int
+}
+
+// NewExpvarObserver publishes an expvar map under name and returns an
+// Observer that records to it. Like expvar.Publish, it panics if name is
+// already in use.
+func NewExpvarObserver(name string) *ExpvarObserver {
+	o := &ExpvarObserver{
+		vars:    expvar.NewMap(name),
+		written: new(expvar.Map),
+		syncMax: new(expvar.Int),
+	}
+	o.vars.Set("bytes_written", o.written)
+	o.vars.Set("sync_max_ns", o.syncMax)
+	return o
+}
+
+// Observe implements Observer.
+func (o *ExpvarObserver) Observe(e Event) {
+	o.vars.Add(string(e.Op), 1)
+	if e.Err != nil {
+		o.vars.Add("errors", 1)
+	}
+	if e.Op == EventSync {
+		ns := e.Duration.Nanoseconds()
+		o.vars.Add("sync_ns", ns)
+		o.mu.Lock()
+		if ns > o.syncMax.Value() {
+			o.syncMax.Set(ns)
+		}
+		o.mu.Unlock()
+	}
+	if e.Written > 0 {
+		o.written.Add(e.mapping(), int64(e.Written))
+	}
+}
+
+// mapping names the mapping of e for use as a metric key.
+func (e Event) mapping() string {
+	if e.Kind == "file" {
+		return e.Path
+	}
+	return e.Kind + ":" + strconv.Itoa(e.ID)
+}
+
+// Int64Counter is a monotonic counter, shaped after the OpenTelemetry
+// metric API.
+type Int64Counter interface {
+	Add(ctx context.Context, incr int64, attrs ...slog.Attr)
+}
+
+// Float64Histogram records a distribution of values, shaped after the
+// OpenTelemetry metric API.
+type Float64Histogram interface {
+	Record(ctx context.Context, v float64, attrs ...slog.Attr)
+}
+
+// Meter creates instruments, shaped after the OpenTelemetry metric.Meter so
+// that an adapter to it is a few lines of glue and this package does not
+// depend on OpenTelemetry.
+type Meter interface {
+	Int64Counter(name string) (Int64Counter, error)
+	Float64Histogram(name string) (Float64Histogram, error)
+}
+
+// MeterObserver is an Observer that records to a Meter. It records
+//
+//	mmap.events        counter of events, with op and kind attributes
+//	mmap.errors        counter of failed operations
+//	mmap.bytes_written counter of bytes written, per mapping
+//	mmap.duration      histogram of operation latency in seconds
+//
+// Every instrument carries the op, kind and mapping attributes.
+type MeterObserver struct {
+	events   Int64Counter
+	errors   Int64Counter
+	written  Int64Counter
+	duration Float64Histogram
+}
+
+// NewMeterObserver creates the instruments of a MeterObserver with m.
+func NewMeterObserver(m Meter) (*MeterObserver, error) {
+	var o MeterObserver
+	var err error
+	if o.events, err = m.Int64Counter("mmap.events"); err != nil {
+		return nil, err
+	}
+	if o.errors, err = m.Int64Counter("mmap.errors"); err != nil {
+		return nil, err
+	}
+	if o.written, err = m.Int64Counter("mmap.bytes_written"); err != nil {
+		return nil, err
+	}
+	if o.duration, err = m.Float64Histogram("mmap.duration"); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Observe implements Observer.
+func (o *MeterObserver) Observe(e Event) {
+	ctx := context.Background()
+	attrs := []slog.Attr{
+		slog.String("op", string(e.Op)),
+		slog.String("kind", e.Kind),
+		slog.String("mapping", e.mapping()),
+	}
+	o.events.Add(ctx, 1, attrs...)
+	if e.Err != nil {
+		o.errors.Add(ctx, 1, attrs...)
+	}
+	if e.Written > 0 {
+		o.written.Add(ctx, int64(e.Written), attrs...)
+	}
+	if e.Duration > 0 {
+		o.duration.Record(ctx, e.Duration.Seconds(), attrs...)
+	}
+}
+
+var (
+	_ Observer = (*ExpvarObserver)(nil)
+	_ Observer = (*MeterObserver)(nil)
+)
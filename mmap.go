@@ -7,4 +7,18 @@ const (
 	ENOENT = syscall.ENOENT
 )
 
+// Region is a mapped byte range that higher level structures can be built
+// on. It is implemented by *MapFile and *MapMem. Writable reports whether
+// the bytes may be written.
+type Region interface {
+	Len() int
+	Bytes() []byte
+	Writable() bool
+}
+
+var (
+	_ Region = (*MapFile)(nil)
+	_ Region = (*MapMem)(nil)
+)
+
 func dummyCloser() error { return nil }
@@ -14,9 +14,15 @@ const (
 	// PROT_GROWSDOWN = syscall.PROT_GROWSDOWN
 	// PROT_GROWSUP   = syscall.PROT_GROWSUP
 
-	MAP_SHARED = syscall.MAP_SHARED
+	MAP_SHARED  = syscall.MAP_SHARED
+	MAP_PRIVATE = syscall.MAP_PRIVATE
 )
 
+// offsetAlignment returns the alignment required of mapping offsets.
+func offsetAlignment() int64 {
+	return int64(pageSize)
+}
+
 // Mmap description of the Go function.
 //
 // Takes fd, offset, length, prot, and flags as parameters.
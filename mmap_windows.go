@@ -22,7 +22,11 @@ const (
 	// PROT_GROWSDOWN = 0x1000000
 	// PROT_GROWSUP   = 0x2000000
 
-	MAP_SHARED = 0x1
+	MAP_SHARED  = 0x1
+	MAP_PRIVATE = 0x2
+
+	// allocationGranularity is the alignment of file mapping views.
+	allocationGranularity = 64 << 10
 )
 
 type Handle = syscall.Handle
@@ -35,7 +39,7 @@ type active struct {
 
 type mmapper struct {
 	sync.Mutex
-	active map[*byte]*active // active mappings; key is last byte in mapping
+	active map[*byte]*active // active mapping handles; key is last byte in mapping, see also Mappings
 	mmap   func(addr, length uintptr, prot, flags, fd int, offset int64) (uintptr, uintptr, error)
 	munmap func(addr uintptr, length uintptr) error
 }
@@ -121,6 +125,11 @@ func (m *mmapper) Flush(data []byte, sz uintptr) (err error) {
 	return flush(Handle(b.fd), data, sz)
 }
 
+// offsetAlignment returns the alignment required of mapping offsets.
+func offsetAlignment() int64 {
+	return allocationGranularity
+}
+
 // Mmap maps the contents of the file at the given path.
 func Mmap(fd int, offset int64, length int, prot int, flags int) (data []byte, err error) {
 	return mapper.Mmap(fd, offset, length, prot, flags)
@@ -140,7 +149,7 @@ func mmap(addr uintptr, length uintptr, prot int, flags int, fd int, offset int6
 	flProtect := uint32(syscall.PAGE_READONLY)
 	dwDesiredAccess := uint32(syscall.FILE_MAP_READ)
 	switch {
-	case prot&PROT_COPY != 0:
+	case prot&PROT_COPY != 0, flags&MAP_PRIVATE != 0:
 		flProtect = syscall.PAGE_WRITECOPY
 		dwDesiredAccess = syscall.FILE_MAP_COPY
 	case prot&PROT_WRITE != 0:
@@ -156,16 +165,15 @@ func mmap(addr uintptr, length uintptr, prot int, flags int, fd int, offset int6
 	// that we wish to allow to be mappable. It is the sum of
 	// the length the user requested, plus the offset where that length
 	// is starting from. This does not map the data into memory.
-	low, high := uint32(length), uint32(length>>32)
+	maxSize := uint64(offset) + uint64(length)
+	low, high := uint32(maxSize), uint32(maxSize>>32)
 	h, errno := syscall.CreateFileMapping(Handle(fd), makeInheritSa(), flProtect, high, low, nil)
 	if errno != nil {
 		return handle, xaddr, os.NewSyscallError("CreateFileMapping", errno)
 	}
 	// Actually map a view of the data into memory. The view's size
 	// is the length the user requested.
-	// fileOffsetHigh := uint32(offset >> 32)
-	// fileOffsetLow := uint32(offset & 0xFFFFFFFF)
-	ptr, errno := syscall.MapViewOfFile(h, dwDesiredAccess, 0, 0, length)
+	ptr, errno := syscall.MapViewOfFile(h, dwDesiredAccess, uint32(offset>>32), uint32(offset), length)
 	if errno != nil {
 		_ = syscall.CloseHandle(h)
 		return handle, xaddr, os.NewSyscallError("MapViewOfFile", errno)
@@ -0,0 +1,373 @@
+package mmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const (
+	npyMagic = "\x93NUMPY"
+	// npyAlign is the alignment of the data of .npy files written by NumPy.
+	npyAlign = 64
+)
+
+// Element is the constraint of the element types of typed views.
+type Element interface {
+	~bool | ~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64 | ~complex64 | ~complex128
+}
+
+// NPY is a NumPy .npy array stored in a memory-mapped file. Its data is
+// accessed in place through NPYView.
+type NPY struct {
+	f       *MapFile
+	path    string
+	dtype   string
+	shape   []int
+	fortran bool
+	data    []byte
+}
+
+// OpenNPY maps the .npy file at path and parses its header. Pass
+// os.O_RDONLY to read the array, or os.O_RDWR to modify it in place.
+func OpenNPY(path string, flag int) (*NPY, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	f, err := OpenFile(path, flag&^os.O_CREATE, 0)
+	if err != nil {
+		return nil, err
+	}
+	a := &NPY{f: f, path: path}
+	if err := a.load(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// CreateNPY creates the .npy file at path, sized for an array of dtype and
+// shape, for example "<f4" and (1000, 768). The data is zeroed and filled
+// in place through NPYView. DtypeOf gives the dtype of a Go type.
+func CreateNPY(path, dtype string, shape ...int) (*NPY, error) {
+	itemSize, err := npyItemSize(dtype)
+	if err != nil {
+		return nil, fmt.Errorf("NPY: %q: %w", path, err)
+	}
+	for _, d := range shape {
+		if d < 0 {
+			return nil, fmt.Errorf("NPY: %q: negative dimension: %w", path, ErrInvalid)
+		}
+	}
+	header := npyHeader(dtype, shape)
+	n, ok := npySize(itemSize, shape, math.MaxInt-len(header))
+	if !ok {
+		return nil, fmt.Errorf("NPY: %q: shape %v too large: %w", path, shape, ErrInvalid)
+	}
+
+	if err := os.Truncate(path, 0); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := OpenFileS(path, os.O_RDWR|os.O_CREATE, 0o644, len(header)+n)
+	if err != nil {
+		return nil, err
+	}
+	copy(f.data, header)
+	a := &NPY{
+		f:     f,
+		path:  path,
+		dtype: dtype,
+		shape: shape,
+		data:  f.data[len(header) : len(header)+n],
+	}
+	return a, nil
+}
+
+// npyHeader returns the magic, version, length and dictionary of the
+// header of an array, padded so the data starts on a 64-byte boundary.
+func npyHeader(dtype string, shape []int) []byte {
+	var dims strings.Builder
+	for i, d := range shape {
+		if i > 0 {
+			dims.WriteString(", ")
+		}
+		dims.WriteString(strconv.Itoa(d))
+	}
+	if len(shape) == 1 {
+		dims.WriteString(",")
+	}
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", dtype, dims.String())
+
+	// Version 1.0 stores the header length in 2 bytes, 2.0 in 4 bytes.
+	prefix := len(npyMagic) + 2 + 2
+	if prefix+len(dict)+1 > 0xffff {
+		prefix += 2
+	}
+	size := (prefix + len(dict) + 1 + npyAlign - 1) &^ (npyAlign - 1)
+	h := make([]byte, 0, size)
+	h = append(h, npyMagic...)
+	if prefix == len(npyMagic)+4 {
+		h = append(h, 1, 0)
+		h = binary.LittleEndian.AppendUint16(h, uint16(size-prefix))
+	} else {
+		h = append(h, 2, 0)
+		h = binary.LittleEndian.AppendUint32(h, uint32(size-prefix))
+	}
+	h = append(h, dict...)
+	for len(h) < size-1 {
+		h = append(h, ' ')
+	}
+	return append(h, '\n')
+}
+
+func (a *NPY) load() error {
+	data := a.f.data
+	if len(data) < len(npyMagic)+4 || string(data[:len(npyMagic)]) != npyMagic {
+		return fmt.Errorf("NPY: %q: %w", a.path, ErrInvalidFormat)
+	}
+	var start, hlen int
+	switch major := data[6]; major {
+	case 1:
+		start, hlen = 10, int(binary.LittleEndian.Uint16(data[8:]))
+	case 2, 3:
+		if len(data) < 12 {
+			return fmt.Errorf("NPY: %q: %w", a.path, ErrInvalidFormat)
+		}
+		start, hlen = 12, int(binary.LittleEndian.Uint32(data[8:]))
+	default:
+		return fmt.Errorf("NPY: unsupported version %d: %w", major, ErrInvalidFormat)
+	}
+	if start+hlen > len(data) {
+		return fmt.Errorf("NPY: %q: truncated header: %w", a.path, ErrInvalidFormat)
+	}
+
+	var err error
+	dict := string(data[start : start+hlen])
+	if a.dtype, a.fortran, a.shape, err = parseNPYHeader(dict); err != nil {
+		return fmt.Errorf("NPY: %q: %w", a.path, err)
+	}
+	itemSize, err := npyItemSize(a.dtype)
+	if err != nil {
+		return fmt.Errorf("NPY: %q: %w", a.path, err)
+	}
+	off := start + hlen
+	n, ok := npySize(itemSize, a.shape, len(data)-off)
+	if !ok {
+		return fmt.Errorf("NPY: %q: %d bytes of data for shape %v: %w", a.path, len(data)-off, a.shape, ErrInvalidFormat)
+	}
+	a.data = data[off : off+n]
+	return nil
+}
+
+// npySize returns the size in bytes of an array of shape with elements of
+// itemSize bytes, and false when it exceeds limit.
+func npySize(itemSize int, shape []int, limit int) (int, bool) {
+	if slices.Contains(shape, 0) {
+		return 0, true
+	}
+	n := itemSize
+	for _, d := range shape {
+		if d > limit/n {
+			return 0, false
+		}
+		n *= d
+	}
+	return n, n <= limit
+}
+
+// parseNPYHeader parses the Python dictionary literal of a .npy header.
+func parseNPYHeader(dict string) (dtype string, fortran bool, shape []int, err error) {
+	bad := fmt.Errorf("invalid header %q: %w", strings.TrimSpace(dict), ErrInvalidFormat)
+	value := func(key string) (string, bool) {
+		_, rest, ok := strings.Cut(dict, "'"+key+"'")
+		if !ok {
+			return "", false
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, ":") {
+			return "", false
+		}
+		return strings.TrimSpace(rest[1:]), true
+	}
+
+	v, ok := value("descr")
+	if !ok {
+		return "", false, nil, bad
+	}
+	if !strings.HasPrefix(v, "'") {
+		// Structured dtypes are given as a list of fields.
+		return "", false, nil, fmt.Errorf("structured dtype: %w", ErrUnsupported)
+	}
+	dtype, _, ok = strings.Cut(v[1:], "'")
+	if !ok {
+		return "", false, nil, bad
+	}
+
+	if v, ok = value("fortran_order"); !ok {
+		return "", false, nil, bad
+	}
+	switch {
+	case strings.HasPrefix(v, "True"):
+		fortran = true
+	case strings.HasPrefix(v, "False"):
+	default:
+		return "", false, nil, bad
+	}
+
+	if v, ok = value("shape"); !ok || !strings.HasPrefix(v, "(") {
+		return "", false, nil, bad
+	}
+	dims, _, ok := strings.Cut(v[1:], ")")
+	if !ok {
+		return "", false, nil, bad
+	}
+	shape = []int{}
+	for _, d := range strings.Split(dims, ",") {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(d, "L"))
+		if err != nil || n < 0 {
+			return "", false, nil, bad
+		}
+		shape = append(shape, n)
+	}
+	return dtype, fortran, shape, nil
+}
+
+// npyItemSize returns the size of an element of dtype, such as "<f4".
+func npyItemSize(dtype string) (int, error) {
+	if len(dtype) < 3 || !strings.ContainsRune("<>|=", rune(dtype[0])) ||
+		!strings.ContainsRune("biufc", rune(dtype[1])) {
+		return 0, fmt.Errorf("dtype %q: %w", dtype, ErrUnsupported)
+	}
+	n, err := strconv.Atoi(dtype[2:])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("dtype %q: %w", dtype, ErrUnsupported)
+	}
+	return n, nil
+}
+
+// Dtype returns the NumPy dtype of the array, such as "<f4".
+func (a *NPY) Dtype() string {
+	return a.dtype
+}
+
+// Shape returns the dimensions of the array.
+func (a *NPY) Shape() []int {
+	return a.shape
+}
+
+// FortranOrder reports whether the array is stored in column-major order.
+func (a *NPY) FortranOrder() bool {
+	return a.fortran
+}
+
+// Len returns the number of elements of the array.
+func (a *NPY) Len() int {
+	n, _ := npySize(1, a.shape, math.MaxInt)
+	return n
+}
+
+// Bytes returns the data of the array. The slice aliases the mapping.
+func (a *NPY) Bytes() []byte {
+	return a.data
+}
+
+// Sync flushes changes to the array to the file.
+func (a *NPY) Sync() error {
+	return a.f.Sync()
+}
+
+// Close unmaps and closes the file.
+func (a *NPY) Close() error {
+	a.data = nil
+	return a.f.Close()
+}
+
+// NPYView returns the data of a as a slice of T, which must match the
+// kind and size of its dtype in native byte order: []float32 for "<f4" on
+// little-endian machines, for example. The slice aliases the mapping and
+// must not be used after Close. An array opened with os.O_RDONLY is mapped
+// read-only: writing to the slice faults.
+func NPYView[T Element](a *NPY) ([]T, error) {
+	if a.data == nil {
+		return nil, &MapError{Op: "NPYView", Path: a.path, Err: ErrClosed}
+	}
+	if want := DtypeOf[T](); !sameDtype(a.dtype, want) {
+		return nil, fmt.Errorf("NPY: %q: dtype %s, want %s: %w", a.path, a.dtype, want, ErrInvalidFormat)
+	}
+	return ViewOf[T](a.data)
+}
+
+// ViewOf returns b as a slice of T without copying, for raw tensors in
+// native byte order. b must be aligned for T and hold a whole number of
+// elements.
+func ViewOf[T Element](b []byte) ([]T, error) {
+	size := int(unsafe.Sizeof(*new(T)))
+	if len(b)%size != 0 {
+		return nil, fmt.Errorf("ViewOf: %d bytes for %d-byte elements: %w", len(b), size, ErrInvalid)
+	}
+	if len(b) == 0 {
+		return []T{}, nil
+	}
+	if uintptr(unsafe.Pointer(&b[0]))%unsafe.Alignof(*new(T)) != 0 {
+		return nil, fmt.Errorf("ViewOf: unaligned data: %w", ErrInvalid)
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(&b[0])), len(b)/size), nil
+}
+
+// DtypeOf returns the NumPy dtype of T in native byte order, such as "<f4"
+// for float32 on little-endian machines.
+func DtypeOf[T Element]() string {
+	t := reflect.TypeFor[T]()
+	var kind byte
+	switch t.Kind() {
+	case reflect.Bool:
+		kind = 'b'
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		kind = 'i'
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		kind = 'u'
+	case reflect.Float32, reflect.Float64:
+		kind = 'f'
+	case reflect.Complex64, reflect.Complex128:
+		kind = 'c'
+	}
+	order := byte('|')
+	if t.Size() > 1 {
+		order = nativeOrder()
+	}
+	return string([]byte{order, kind}) + strconv.Itoa(int(t.Size()))
+}
+
+// nativeOrder returns the NumPy byte order character of the machine.
+func nativeOrder() byte {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) == 1 {
+		return '<'
+	}
+	return '>'
+}
+
+// sameDtype reports whether dtypes a and b describe the same elements in
+// the same byte order.
+func sameDtype(a, b string) bool {
+	norm := func(d string) string {
+		if len(d) > 0 && d[0] == '=' {
+			return string(nativeOrder()) + d[1:]
+		}
+		// Byte order does not apply to one-byte elements.
+		if strings.HasSuffix(d, "1") && len(d) == 3 {
+			return "|" + d[1:]
+		}
+		return d
+	}
+	return norm(a) == norm(b)
+}
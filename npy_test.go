@@ -0,0 +1,141 @@
+package mmap_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+// npyFile returns a .npy file as NumPy writes it with np.save.
+func npyFile(dict string, data []byte) []byte {
+	hlen := (10+len(dict)+1+63)/64*64 - 10
+	b := []byte("\x93NUMPY\x01\x00")
+	b = append(b, byte(hlen), byte(hlen>>8))
+	b = append(b, dict...)
+	b = append(b, strings.Repeat(" ", hlen-len(dict)-1)...)
+	b = append(b, '\n')
+	return append(b, data...)
+}
+
+func TestOpenNPY(t *testing.T) {
+	// np.save("a.npy", np.arange(5, dtype="<i8"))
+	data := make([]byte, 0, 40)
+	for i := range 5 {
+		data = append(data, byte(i), 0, 0, 0, 0, 0, 0, 0)
+	}
+	path := filepath.Join(t.TempDir(), "a.npy")
+	if err := os.WriteFile(path, npyFile("{'descr': '<i8', 'fortran_order': False, 'shape': (5,), }", data), 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+
+	a, err := mmap.OpenNPY(path, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("could not open: %+v", err)
+	}
+	defer a.Close()
+	if a.Dtype() != "<i8" || len(a.Shape()) != 1 || a.Shape()[0] != 5 || a.FortranOrder() || a.Len() != 5 {
+		t.Fatalf("invalid array: dtype=%s, shape=%v", a.Dtype(), a.Shape())
+	}
+	v, err := mmap.NPYView[int64](a)
+	if err != nil {
+		t.Fatalf("could not view: %+v", err)
+	}
+	for i, x := range v {
+		if x != int64(i) {
+			t.Fatalf("invalid element %d: %d", i, x)
+		}
+	}
+	if _, err := mmap.NPYView[float64](a); !errors.Is(err, mmap.ErrInvalidFormat) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalidFormat)
+	}
+}
+
+func TestOpenNPYInvalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"magic", []byte("not a numpy file"), mmap.ErrInvalidFormat},
+		{"short", npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }", make([]byte, 20)), mmap.ErrInvalidFormat},
+		{"structured", npyFile("{'descr': [('a', '<f4')], 'fortran_order': False, 'shape': (1,), }", make([]byte, 4)), mmap.ErrUnsupported},
+		{"overflow", npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (4611686018427387904, 4), }", make([]byte, 4)), mmap.ErrInvalidFormat},
+		{"negative", npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (3074457345618258603, 3), }", make([]byte, 4)), mmap.ErrInvalidFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".npy")
+			if err := os.WriteFile(path, tt.file, 0o644); err != nil {
+				t.Fatalf("could not write file: %+v", err)
+			}
+			if _, err := mmap.OpenNPY(path, os.O_RDONLY); !errors.Is(err, tt.want) {
+				t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, tt.want)
+			}
+		})
+	}
+
+	path := filepath.Join(dir, "big.npy")
+	if err := os.WriteFile(path, npyFile("{'descr': '>f4', 'fortran_order': True, 'shape': (2,), }", make([]byte, 8)), 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	a, err := mmap.OpenNPY(path, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("could not open: %+v", err)
+	}
+	defer a.Close()
+	if !a.FortranOrder() {
+		t.Fatal("invalid order")
+	}
+	if _, err := mmap.NPYView[float32](a); !errors.Is(err, mmap.ErrInvalidFormat) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalidFormat)
+	}
+}
+
+func TestCreateNPY(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emb.npy")
+	a, err := mmap.CreateNPY(path, mmap.DtypeOf[float32](), 3, 4)
+	if err != nil {
+		t.Fatalf("could not create: %+v", err)
+	}
+	v, err := mmap.NPYView[float32](a)
+	if err != nil {
+		t.Fatalf("could not view: %+v", err)
+	}
+	if len(v) != 12 {
+		t.Fatalf("invalid length: %d", len(v))
+	}
+	for i := range v {
+		v[i] = float32(i) / 2
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("could not close: %+v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read file: %+v", err)
+	}
+	want := npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (3, 4), }", nil)
+	if got := b[:len(want)]; string(got) != string(want) || len(b) != len(want)+48 {
+		t.Fatalf("invalid header:\ngot= %q\nwant=%q", got, want)
+	}
+
+	a, err = mmap.OpenNPY(path, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("could not open: %+v", err)
+	}
+	defer a.Close()
+	v, err = mmap.NPYView[float32](a)
+	if err != nil || v[11] != 5.5 {
+		t.Fatalf("invalid data: %v, %+v", v, err)
+	}
+
+	if _, err := mmap.CreateNPY(path+".big", "<f4", 1<<62, 4); !errors.Is(err, mmap.ErrInvalid) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+	}
+}
@@ -0,0 +1,140 @@
+package mmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventOp identifies the operation reported by an Event.
+type EventOp string
+
+const (
+	EventOpen       EventOp = "open"
+	EventClose      EventOp = "close"
+	EventSync       EventOp = "sync"
+	EventRemap      EventOp = "remap"
+	EventFault      EventOp = "fault"
+	EventShortWrite EventOp = "short_write"
+)
+
+// Event describes an operation on a mapping.
+type Event struct {
+	Op EventOp
+	// Kind is "file" for MapFile, "mem" for SysV or named shared memory,
+	// "fd" for memfd-backed and "anon" for anonymous MapMem mappings.
+	Kind string
+	// Path is the mapped file, empty for shared memory.
+	Path string
+	// ID is the shared memory id, zero for files.
+	ID int
+	// Size is the size of the mapping after the operation.
+	Size int
+	// Offset and Len are the range of a fault or short write.
+	Offset int64
+	Len    int
+	// Written is the number of bytes written through the handle since its
+	// previous sync or close event. It is set for EventSync and EventClose.
+	Written uint64
+	// Duration is the time the operation took, for open, close, sync and
+	// remap events.
+	Duration time.Duration
+	Err      error
+}
+
+// Observer receives the events of every mapping. Observe is called
+// synchronously from the goroutine doing the operation and must not block.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc adapts an ordinary function to the Observer interface.
+type ObserverFunc func(e Event)
+
+func (fn ObserverFunc) Observe(e Event) {
+	fn(e)
+}
+
+type observerHolder struct {
+	Observer
+}
+
+var observer atomic.Pointer[observerHolder]
+
+// SetObserver installs o to receive the events of all mappings. A nil
+// observer disables the events.
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&observerHolder{o})
+}
+
+// observing reports whether an observer is installed, so callers can skip
+// timing operations nobody looks at.
+func observing() bool {
+	return observer.Load() != nil
+}
+
+func observe(e Event) {
+	if h := observer.Load(); h != nil {
+		h.Observe(e)
+	}
+}
+
+// since returns the time elapsed since start, or zero when start is zero
+// because nobody was observing when the operation began.
+func since(start time.Time) time.Duration {
+	if start.IsZero() {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// now returns the current time when an observer is installed.
+func now() time.Time {
+	if !observing() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (f *MapFile) observe(op EventOp, start time.Time, off int64, n int, err error) {
+	if !observing() {
+		return
+	}
+	e := Event{
+		Op:       op,
+		Kind:     "file",
+		Path:     f.path,
+		Size:     len(f.data),
+		Offset:   off,
+		Len:      n,
+		Duration: since(start),
+		Err:      err,
+	}
+	if op == EventSync || op == EventClose {
+		e.Written, f.written = f.written, 0
+	}
+	observe(e)
+}
+
+func (f *MapMem) observe(op EventOp, start time.Time, off int64, n int, err error) {
+	if !observing() {
+		return
+	}
+	e := Event{
+		Op:       op,
+		Kind:     f.kind(),
+		ID:       f.id,
+		Size:     len(f.data),
+		Offset:   off,
+		Len:      n,
+		Duration: since(start),
+		Err:      err,
+	}
+	if op == EventSync || op == EventClose {
+		e.Written, f.written = f.written, 0
+	}
+	observe(e)
+}
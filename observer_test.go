@@ -0,0 +1,154 @@
+package mmap_test
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestObserver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+
+	var mu sync.Mutex
+	var events []mmap.Event
+	mmap.SetObserver(mmap.ObserverFunc(func(e mmap.Event) {
+		if e.Path != path {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}))
+	defer mmap.SetObserver(nil)
+
+	f, err := mmap.OpenFileS(path, os.O_RDWR, 0o644, 16)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	if _, err := f.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("could not sync: %+v", err)
+	}
+	_, _ = f.WriteAt([]byte("world"), 14)
+	if err := f.Close(); err != nil {
+		t.Fatalf("could not close: %+v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var ops []mmap.EventOp
+	for _, e := range events {
+		ops = append(ops, e.Op)
+	}
+	want := []mmap.EventOp{
+		mmap.EventOpen, mmap.EventSync, mmap.EventShortWrite,
+		mmap.EventSync, mmap.EventClose,
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("invalid events:\ngot= %v\nwant=%v", ops, want)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Fatalf("invalid events:\ngot= %v\nwant=%v", ops, want)
+		}
+	}
+	if got, want := events[1].Written, uint64(5); got != want {
+		t.Fatalf("invalid bytes written at first sync: got=%d, want=%d", got, want)
+	}
+	if got, want := events[3].Written, uint64(2); got != want {
+		t.Fatalf("invalid bytes written at close: got=%d, want=%d", got, want)
+	}
+	if events[1].Duration <= 0 {
+		t.Fatalf("sync latency not recorded: %+v", events[1])
+	}
+	if got, want := events[2].Len, 5; got != want || events[2].Offset != 14 {
+		t.Fatalf("invalid short write range: %+v", events[2])
+	}
+}
+
+type testCounter struct {
+	mu    *sync.Mutex
+	total map[string]int64
+	name  string
+}
+
+func (c testCounter) Add(_ context.Context, incr int64, attrs ...slog.Attr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total[c.name] += incr
+}
+
+func (c testCounter) Record(_ context.Context, v float64, attrs ...slog.Attr) {
+	c.Add(context.Background(), 1, attrs...)
+}
+
+type testMeter struct {
+	mu    sync.Mutex
+	total map[string]int64
+}
+
+func (m *testMeter) Int64Counter(name string) (mmap.Int64Counter, error) {
+	return testCounter{mu: &m.mu, total: m.total, name: name}, nil
+}
+
+func (m *testMeter) Float64Histogram(name string) (mmap.Float64Histogram, error) {
+	return testCounter{mu: &m.mu, total: m.total, name: name}, nil
+}
+
+// expvarObserver is published once per test binary, since expvar names
+// cannot be reused when the tests run more than once.
+var expvarObserver = sync.OnceValue(func() *mmap.ExpvarObserver {
+	return mmap.NewExpvarObserver("mmap_test")
+})
+
+func TestObserverAdapters(t *testing.T) {
+	meter := &testMeter{total: make(map[string]int64)}
+	mo, err := mmap.NewMeterObserver(meter)
+	if err != nil {
+		t.Fatalf("could not create meter observer: %+v", err)
+	}
+	eo := expvarObserver()
+	mmap.SetObserver(mmap.ObserverFunc(func(e mmap.Event) {
+		mo.Observe(e)
+		eo.Observe(e)
+	}))
+	defer mmap.SetObserver(nil)
+
+	path := filepath.Join(t.TempDir(), "data")
+	f, err := mmap.OpenFileS(path, os.O_RDWR, 0o644, 16)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("could not close: %+v", err)
+	}
+
+	vars := expvar.Get("mmap_test").(*expvar.Map)
+	if got := vars.Get("sync").(*expvar.Int).Value(); got < 1 {
+		t.Fatalf("sync not counted: %d", got)
+	}
+	written := vars.Get("bytes_written").(*expvar.Map).Get(path)
+	if written == nil || written.(*expvar.Int).Value() != 5 {
+		t.Fatalf("invalid bytes written: %v", written)
+	}
+
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	if got, want := meter.total["mmap.bytes_written"], int64(5); got != want {
+		t.Fatalf("invalid bytes written: got=%d, want=%d", got, want)
+	}
+	if meter.total["mmap.events"] < 3 || meter.total["mmap.duration"] < 3 {
+		t.Fatalf("events not recorded: %v", meter.total)
+	}
+}
@@ -0,0 +1,228 @@
+package mmap
+
+import (
+	"log/slog"
+	"os"
+)
+
+// SyncPolicy controls when a writable MapFile is flushed to its file.
+type SyncPolicy int
+
+const (
+	// SyncOnClose flushes the mapping when it is closed. It is the default.
+	SyncOnClose SyncPolicy = iota
+	// SyncNever leaves write back to the operating system; only explicit
+	// calls to Sync flush the mapping.
+	SyncNever
+	// SyncAlways flushes the pages touched by every write before the write
+	// returns.
+	SyncAlways
+)
+
+// Option configures OpenFileWith and OpenMemWith.
+type Option func(*options)
+
+// options is the configuration of a mapping shared by all platforms. Not
+// every option applies to every kind of mapping; see the With functions.
+type options struct {
+	flag     int
+	perm     os.FileMode
+	size     int
+	offset   int64
+	prot     int
+	private  bool
+	populate bool
+	huge     bool
+	hugeSize int
+	thp      bool
+	memfd    bool
+	tag      string
+	header   bool
+	// autoRemove marks a new SysV segment for removal once attached.
+	autoRemove bool
+	// noCreate keeps a file mapping from creating a missing file.
+	noCreate bool
+	// permSet records that WithPerm was given, as segments default to 0o600
+	// rather than to the file permissions.
+	permSet bool
+	uid     int
+	gid     int
+	sddl    string
+	// headerType and headerVersion are the type tag and schema version of
+	// the segment header.
+	headerType    uint32
+	headerVersion uint32
+	sync          SyncPolicy
+	logger        *slog.Logger
+	id            int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		flag: os.O_RDONLY,
+		perm: 0o644,
+		id:   MapMemKeyInvalid,
+		uid:  -1,
+		gid:  -1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) log() *slog.Logger {
+	if o.logger != nil {
+		return o.logger
+	}
+	return Log()
+}
+
+// WithFlag sets the os.OpenFile flag of a file mapping. The default is
+// os.O_RDONLY; os.O_CREATE is always added.
+func WithFlag(flag int) Option {
+	return func(o *options) { o.flag = flag }
+}
+
+// WithPerm sets the permissions of a file created by OpenFileWith, or of a
+// SysV segment or memfd created by OpenMemWith. Segments default to 0o600.
+func WithPerm(perm os.FileMode) Option {
+	return func(o *options) {
+		o.perm = perm
+		o.permSet = true
+	}
+}
+
+// WithOwner sets the owning user and group of a SysV segment or memfd
+// created by OpenMemWith. A uid or gid of -1 leaves it unchanged. Changing
+// the owner usually requires privileges; on Windows use
+// WithSecurityDescriptor instead.
+func WithOwner(uid, gid int) Option {
+	return func(o *options) { o.uid, o.gid = uid, gid }
+}
+
+// WithSecurityDescriptor sets the security descriptor, in SDDL form, of the
+// named memory created by OpenMemWith on Windows, for example
+// "D:P(A;;GA;;;SY)(A;;GRGW;;;BU)". It is ignored on other platforms.
+func WithSecurityDescriptor(sddl string) Option {
+	return func(o *options) { o.sddl = sddl }
+}
+
+// WithSize sets the size of the mapping. A writable file shorter than
+// offset+size is extended; the file mapping still covers the file up to
+// its end. For shared memory it is the size of the segment to create or
+// attach, zero meaning one page or the whole segment.
+func WithSize(size int) Option {
+	return func(o *options) { o.size = size }
+}
+
+// WithOffset maps a file from offset instead of its start. The offset
+// must be a multiple of the page size, or of 64 KiB on Windows.
+func WithOffset(offset int64) Option {
+	return func(o *options) { o.offset = offset }
+}
+
+// WithProt overrides the memory protection of a file mapping, which is
+// derived from the open flag otherwise. The file must be opened with a
+// flag that allows the requested access.
+func WithProt(prot int) Option {
+	return func(o *options) { o.prot = prot }
+}
+
+// WithPrivate makes a file mapping copy-on-write: writes are visible to
+// this handle only and never reach the file, so a read-only file can be
+// mapped writable.
+func WithPrivate() Option {
+	return func(o *options) { o.private = true }
+}
+
+// WithPopulate prefaults the whole mapping when it is opened, so first
+// accesses do not stall on page faults. Linux file mappings use
+// MAP_POPULATE; other mappings are touched page by page as Prefault does.
+// Use Prefault directly to follow the progress of, or cancel, the
+// prefault of a large mapping.
+func WithPopulate() Option {
+	return func(o *options) { o.populate = true }
+}
+
+// WithHugePages backs shared memory with huge pages of size bytes, which
+// is HugePage2M, HugePage1G or HugePageDefault for the system default. The
+// size of the mapping is rounded up to a multiple of the huge page size.
+// It uses SHM_HUGETLB on Linux and large pages on Windows, where the
+// process needs the SeLockMemoryPrivilege; other systems return
+// ErrUnsupported.
+func WithHugePages(size int) Option {
+	return func(o *options) {
+		o.huge = true
+		o.hugeSize = size
+	}
+}
+
+// WithTransparentHugePages advises the kernel to back the mapping with
+// transparent huge pages (MADV_HUGEPAGE). It only has an effect on Linux.
+func WithTransparentHugePages() Option {
+	return func(o *options) { o.thp = true }
+}
+
+// WithSync sets the sync policy of a writable file mapping.
+func WithSync(policy SyncPolicy) Option {
+	return func(o *options) { o.sync = policy }
+}
+
+// WithLogger sets the logger of the handle, as SetLogger does, from the
+// moment it is opened.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithMemfd backs the memory created by OpenMemWith with an anonymous file
+// (memfd_create on Linux, an unlinked temporary file elsewhere) instead of
+// a SysV segment. Such memory has no global name; share it with SendTo or
+// by passing it to a child process. It is unsupported on Windows.
+func WithMemfd() Option {
+	return func(o *options) { o.memfd = true }
+}
+
+// WithTag attaches a user tag to memory created by OpenMemWith. The tag
+// travels with the memory when it is sent with SendTo, and names it for
+// AttachToCmd.
+func WithTag(tag string) Option {
+	return func(o *options) { o.tag = tag }
+}
+
+// WithHeader makes OpenMemWith write a segment header with the type tag
+// typ and schema version when it creates a segment, and require a header
+// with the same type and version when it attaches to one with WithID. The
+// header precedes the payload, which starts at offset 0 of the MapMem and
+// defaults to one page as without a header.
+// It does not apply to memory created with WithMemfd.
+func WithHeader(typ, version uint32) Option {
+	return func(o *options) {
+		o.header = true
+		o.headerType, o.headerVersion = typ, version
+	}
+}
+
+// WithAutoRemove marks a SysV segment for removal right after OpenMemWith
+// creates and attaches it, so the system frees it when the last process
+// detaches, even if the owner crashes. Processes can still attach to it by
+// id on Linux, but no longer find it by key. Windows named memory and
+// memfd-backed memory already go away with their last handle, so the
+// option does not change them.
+func WithAutoRemove() Option {
+	return func(o *options) { o.autoRemove = true }
+}
+
+// WithID attaches OpenMemWith to the shared memory segment id instead of
+// creating a new one.
+func WithID(id int) Option {
+	return func(o *options) { o.id = id }
+}
+
+// segmentPerm returns the permissions of a segment to create.
+func (o *options) segmentPerm() os.FileMode {
+	if o.permSet {
+		return o.perm & os.ModePerm
+	}
+	return 0o600
+}
@@ -0,0 +1,112 @@
+package mmap_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestOpenFileWith(t *testing.T) {
+	// 64 KiB is a valid offset on every platform.
+	const offset = 64 << 10
+	path := filepath.Join(t.TempDir(), "data")
+	content := append(bytes.Repeat([]byte{'a'}, offset), "hello world"...)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatalf("could not seed file: %+v", err)
+	}
+
+	t.Run("offset", func(t *testing.T) {
+		f, err := mmap.OpenFileWith(path, mmap.WithOffset(offset))
+		if err != nil {
+			t.Fatalf("could not open file: %+v", err)
+		}
+		defer f.Close()
+		if got, want := f.Bytes(), []byte("hello world"); !bytes.Equal(got, want) {
+			t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+		}
+
+		_, err = mmap.OpenFileWith(path, mmap.WithOffset(offset+1))
+		if !errors.Is(err, mmap.ErrInvalid) {
+			t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrInvalid)
+		}
+	})
+
+	t.Run("private", func(t *testing.T) {
+		f, err := mmap.OpenFileWith(path, mmap.WithPrivate())
+		if err != nil {
+			t.Fatalf("could not open file: %+v", err)
+		}
+		if _, err := f.WriteAt([]byte("bye"), offset); err != nil {
+			t.Fatalf("could not write to private mapping: %+v", err)
+		}
+		if got, want := f.Bytes()[offset:], []byte("byelo world"); !bytes.Equal(got, want) {
+			t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("could not close: %+v", err)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("could not read file: %+v", err)
+		}
+		if !bytes.Equal(raw, content) {
+			t.Fatal("private write reached the file")
+		}
+	})
+
+	t.Run("prot", func(t *testing.T) {
+		f, err := mmap.OpenFileWith(path, mmap.WithFlag(os.O_RDWR), mmap.WithProt(mmap.PROT_READ))
+		if err != nil {
+			t.Fatalf("could not open file: %+v", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteAt([]byte("x"), 0); !errors.Is(err, mmap.ErrBadFileDesc) {
+			t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+		}
+	})
+
+	t.Run("sync-always", func(t *testing.T) {
+		f, err := mmap.OpenFileWith(path, mmap.WithFlag(os.O_RDWR), mmap.WithSync(mmap.SyncAlways))
+		if err != nil {
+			t.Fatalf("could not open file: %+v", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteAt([]byte("bye"), offset+100); err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, err := f.WriteAt([]byte("bye"), offset); err != nil {
+			t.Fatalf("could not write: %+v", err)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("could not read file: %+v", err)
+		}
+		if got, want := raw[offset:], []byte("byelo world"); !bytes.Equal(got, want) {
+			t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+		}
+	})
+}
+
+func TestOpenMemWith(t *testing.T) {
+	w, err := mmap.OpenMemWith(mmap.WithSize(1024))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+
+	r, err := mmap.OpenMemWith(mmap.WithID(w.ID()), mmap.WithSize(5))
+	if err != nil {
+		t.Fatalf("could not attach memory: %+v", err)
+	}
+	defer r.Close()
+	if got, want := r.Bytes(), []byte("hello"); !bytes.Equal(got, want) {
+		t.Fatalf("invalid content:\ngot= %q\nwant=%q", got, want)
+	}
+}
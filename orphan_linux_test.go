@@ -0,0 +1,95 @@
+//go:build linux
+
+package mmap_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+// TestOrphanChild runs in the child process started by TestOrphans. It
+// leaves its segments behind as if it crashed.
+func TestOrphanChild(t *testing.T) {
+	if os.Getenv("MMAP_TEST_ORPHAN") == "" {
+		t.Skip("only runs as a child of TestOrphans")
+	}
+	leaked, err := mmap.OpenMemWith(mmap.WithSize(4096))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	removed, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithAutoRemove())
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	fmt.Printf("ids %d %d\n", leaked.ID(), removed.ID())
+	os.Exit(0)
+}
+
+func TestOrphans(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOrphanChild$")
+	cmd.Env = append(os.Environ(), "MMAP_TEST_ORPHAN=1")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("child failed: %+v\n%s", err, out)
+	}
+	var leaked, removed int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "ids %d %d", &leaked, &removed); err != nil {
+		t.Fatalf("invalid child output %q: %+v", out, err)
+	}
+
+	if _, ok := findSegment(t, removed); ok {
+		t.Fatalf("auto-removed segment %d still listed", removed)
+	}
+	orphans, err := mmap.Orphans()
+	if err != nil {
+		t.Fatalf("could not list orphans: %+v", err)
+	}
+	found := false
+	for _, s := range orphans {
+		found = found || s.ID == leaked
+	}
+	if !found {
+		t.Fatalf("segment %d not in orphans %+v", leaked, orphans)
+	}
+
+	if _, err := mmap.RemoveOrphans(); err != nil {
+		t.Fatalf("could not remove orphans: %+v", err)
+	}
+	if _, ok := findSegment(t, leaked); ok {
+		t.Fatalf("orphan %d still listed", leaked)
+	}
+}
+
+func TestAutoRemove(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithAutoRemove())
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	// Linux still attaches removed segments by id.
+	r, err := mmap.OpenMemS(m.ID())
+	if err != nil {
+		t.Fatalf("could not attach: %+v", err)
+	}
+	if _, err := m.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := r.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+		t.Fatalf("invalid read: %q, %+v", buf, err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("could not close: %+v", err)
+	}
+	if _, ok := findSegment(t, r.ID()); !ok {
+		t.Fatalf("segment %d freed while attached", r.ID())
+	}
+	_ = r.Close()
+	if _, ok := findSegment(t, r.ID()); ok {
+		t.Fatalf("segment %d not freed", r.ID())
+	}
+}
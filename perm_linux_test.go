@@ -0,0 +1,99 @@
+//go:build linux
+
+package mmap_test
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestSegmentPerm(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithPerm(0o640))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if s, _ := findSegment(t, m.ID()); s.Mode != 0o640 {
+		t.Fatalf("invalid mode: got=%v, want=%v", s.Mode, os.FileMode(0o640))
+	}
+
+	if err := m.Chmod(0o660); err != nil {
+		t.Fatalf("could not chmod: %+v", err)
+	}
+	if s, _ := findSegment(t, m.ID()); s.Mode != 0o660 {
+		t.Fatalf("invalid mode: got=%v, want=%v", s.Mode, os.FileMode(0o660))
+	}
+	if err := m.Chown(-1, os.Getgid()); err != nil {
+		t.Fatalf("could not chown: %+v", err)
+	}
+
+	a, err := mmap.OpenAnon(4096)
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer a.Close()
+	if err := a.Chmod(0o600); err == nil {
+		t.Fatal("changed the mode of anonymous memory")
+	}
+}
+
+func TestSegmentOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner requires root")
+	}
+	m, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithOwner(65534, 65534))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if s, _ := findSegment(t, m.ID()); s.UID != 65534 || s.GID != 65534 {
+		t.Fatalf("invalid owner: uid=%d, gid=%d", s.UID, s.GID)
+	}
+}
+
+func TestSegmentGroupRead(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(4096), mmap.WithPerm(0o640))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if _, err := m.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+
+	if os.Getuid() == 0 {
+		// Attach as another user of the group of the segment, which may
+		// only read it.
+		const uid, gid = 65533, 65534
+		if err := m.Chown(-1, gid); err != nil {
+			t.Fatalf("could not chown: %+v", err)
+		}
+		if err := syscall.Setegid(gid); err != nil {
+			t.Skipf("could not change group: %v", err)
+		}
+		defer func() { _ = syscall.Setegid(0) }()
+		if err := syscall.Seteuid(uid); err != nil {
+			t.Skipf("could not change user: %v", err)
+		}
+		defer func() { _ = syscall.Seteuid(0) }()
+	} else if err := m.Chmod(0o440); err != nil {
+		t.Fatalf("could not chmod: %+v", err)
+	}
+
+	r, err := mmap.OpenMemS(m.ID())
+	if err != nil {
+		t.Fatalf("could not attach: %+v", err)
+	}
+	defer r.Close()
+	buf := make([]byte, 5)
+	if _, err := r.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+		t.Fatalf("invalid read: %q, %+v", buf, err)
+	}
+	if _, err := r.WriteAt(buf, 0); !errors.Is(err, mmap.ErrBadFileDesc) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, mmap.ErrBadFileDesc)
+	}
+}
@@ -0,0 +1,97 @@
+//go:build linux || darwin || freebsd
+
+package mmap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+// Chmod changes the permissions of the SysV segment or memfd of f. Only
+// the owner of the segment or a privileged process may change them.
+func (f *MapMem) Chmod(mode os.FileMode) error {
+	if f.data == nil {
+		return f.error("Chmod", 0, 0, ErrClosed)
+	}
+	var err error
+	switch {
+	case f.anon:
+		err = ErrUnsupported
+	case f.file != nil:
+		err = underlyingError(f.file.Chmod(mode))
+	default:
+		err = setShmPerm(f.id, func(perm *syscall.SysvIpcPerm) {
+			setMode(&perm.Mode, mode)
+		})
+	}
+	if err != nil {
+		return f.error("Chmod", 0, 0, err)
+	}
+	return nil
+}
+
+// Chown changes the owning user and group of the SysV segment or memfd of
+// f. A uid or gid of -1 leaves it unchanged.
+func (f *MapMem) Chown(uid, gid int) error {
+	if f.data == nil {
+		return f.error("Chown", 0, 0, ErrClosed)
+	}
+	var err error
+	switch {
+	case f.anon:
+		err = ErrUnsupported
+	case f.file != nil:
+		err = underlyingError(f.file.Chown(uid, gid))
+	default:
+		err = chownShm(f.id, uid, gid)
+	}
+	if err != nil {
+		return f.error("Chown", 0, 0, err)
+	}
+	return nil
+}
+
+func chownShm(id, uid, gid int) error {
+	return setShmPerm(id, func(perm *syscall.SysvIpcPerm) {
+		if uid != -1 {
+			perm.Uid = uint32(uid)
+		}
+		if gid != -1 {
+			perm.Gid = uint32(gid)
+		}
+	})
+}
+
+// setShmPerm applies fn to the permissions of segment id.
+func setShmPerm(id int, fn func(perm *syscall.SysvIpcPerm)) error {
+	var desc syscall.SysvShmDesc
+	if _, err := syscall.SysvShmCtl(id, syscall.IPC_STAT, &desc); err != nil {
+		return permissionError(os.NewSyscallError("SysvShmCtl", err), "")
+	}
+	fn(&desc.Perm)
+	if _, err := syscall.SysvShmCtl(id, syscall.IPC_SET, &desc); err != nil {
+		return permissionError(os.NewSyscallError("SysvShmCtl", err), "only the owner of the segment may change it")
+	}
+	return nil
+}
+
+// setMode replaces the permission bits of a SysV mode, whose type differs
+// between platforms.
+func setMode[T ~uint16 | ~uint32](m *T, mode os.FileMode) {
+	*m = *m&^T(os.ModePerm) | T(mode&os.ModePerm)
+}
+
+// permissionError turns a permission failure into ErrPermission with a hint
+// at the access that was missing, and returns other errors as is.
+func permissionError(err error, hint string) error {
+	if !errors.Is(err, ErrPermission) {
+		return err
+	}
+	if hint == "" {
+		return fmt.Errorf("%w: %v", ErrPermission, err)
+	}
+	return fmt.Errorf("%w: %s (uid %d, gid %d): %v", ErrPermission, hint, os.Getuid(), os.Getgid(), err)
+}
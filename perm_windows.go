@@ -0,0 +1,31 @@
+package mmap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Chmod is unsupported on Windows; create the memory with
+// WithSecurityDescriptor instead.
+func (f *MapMem) Chmod(mode os.FileMode) error {
+	return f.error("Chmod", 0, 0, ErrUnsupported)
+}
+
+// Chown is unsupported on Windows; create the memory with
+// WithSecurityDescriptor instead.
+func (f *MapMem) Chown(uid, gid int) error {
+	return f.error("Chown", 0, 0, ErrUnsupported)
+}
+
+// permissionError turns a permission failure into ErrPermission with a hint
+// at the access that was missing, and returns other errors as is.
+func permissionError(err error, hint string) error {
+	if !errors.Is(err, ErrPermission) {
+		return err
+	}
+	if hint == "" {
+		return fmt.Errorf("%w: %v", ErrPermission, err)
+	}
+	return fmt.Errorf("%w: %s: %v", ErrPermission, hint, err)
+}
@@ -0,0 +1,11 @@
+//go:build linux
+
+package mmap
+
+import (
+	syscall "golang.org/x/sys/unix"
+)
+
+// mapPopulate asks mmap to prefault the mapping. It is zero on systems
+// without MAP_POPULATE, where pages are touched after mapping instead.
+const mapPopulate = syscall.MAP_POPULATE
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package mmap
+
+// mapPopulate asks mmap to prefault the mapping. It is zero on systems
+// without MAP_POPULATE, where pages are touched after mapping instead.
+const mapPopulate = 0
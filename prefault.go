@@ -0,0 +1,94 @@
+package mmap
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// prefaultChunk is the amount of memory a prefault worker touches between
+// checks for cancellation and progress reports.
+const prefaultChunk = 16 << 20
+
+// Prefault touches every page of r so later accesses do not fault. The
+// pages are touched by GOMAXPROCS goroutines in parallel. progress, when
+// not nil, is called from the calling goroutine with the number of bytes
+// done so far. Prefault stops early and returns ctx.Err() when ctx is
+// cancelled.
+func Prefault(ctx context.Context, r Region, progress func(done, total int)) error {
+	return prefault(ctx, r.Bytes(), progress)
+}
+
+func prefault(ctx context.Context, data []byte, progress func(done, total int)) error {
+	total := len(data)
+	if total == 0 {
+		return nil
+	}
+	chunks := (total + prefaultChunk - 1) / prefaultChunk
+	workers := min(runtime.GOMAXPROCS(0), chunks)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	next := make(chan int)
+	done := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range next {
+				end := min(c+prefaultChunk, total)
+				touchPages(data[c:end])
+				select {
+				case done <- end - c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(next)
+		for c := 0; c < total; c += prefaultChunk {
+			select {
+			case next <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var err error
+	for n := 0; n < total; {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case d := <-done:
+			n += d
+			if progress != nil {
+				progress(n, total)
+			}
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// touchSink keeps the reads of touchPages from being optimised away.
+var touchSink atomic.Uint32
+
+// touchPages reads one byte of every page of b.
+func touchPages(b []byte) {
+	var v byte
+	for i := 0; i < len(b); i += pageSize {
+		v ^= b[i]
+	}
+	v ^= b[len(b)-1]
+	touchSink.Store(uint32(v))
+}
@@ -0,0 +1,53 @@
+package mmap_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestPrefault(t *testing.T) {
+	const size = 40 << 20
+	path := filepath.Join(t.TempDir(), "data")
+	f, err := mmap.OpenFileWith(path, mmap.WithFlag(os.O_RDWR), mmap.WithSize(size), mmap.WithPopulate())
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+
+	var last, calls int
+	err = mmap.Prefault(context.Background(), f, func(done, total int) {
+		if done <= last || total != size {
+			t.Errorf("invalid progress: done=%d, last=%d, total=%d", done, last, total)
+		}
+		last = done
+		calls++
+	})
+	if err != nil {
+		t.Fatalf("could not prefault: %+v", err)
+	}
+	if last != size || calls != 3 {
+		t.Fatalf("invalid progress: last=%d, calls=%d", last, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = mmap.Prefault(ctx, f, func(done, total int) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, context.Canceled)
+	}
+}
+
+func TestOpenMemPopulate(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(1<<20), mmap.WithPopulate())
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+	if got, want := m.Len(), 1<<20; got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+}
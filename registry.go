@@ -0,0 +1,117 @@
+package mmap
+
+import (
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MappingInfo describes a live mapping created by this package.
+type MappingInfo struct {
+	// Kind is "file" for MapFile, "mem" for SysV or named shared memory,
+	// "fd" for memfd-backed and "anon" for anonymous MapMem mappings.
+	Kind string
+	// Path is the mapped file, empty for shared memory.
+	Path string
+	// ID is the shared memory id, zero for files.
+	ID    int
+	Size  int
+	Prot  int
+	Owner bool
+	// Created is the time the mapping was established.
+	Created time.Time
+	// Stack is the stack trace of the code that created the mapping. It is
+	// only captured when debug logging is enabled.
+	Stack string
+}
+
+// registry tracks the live mappings of the process. Entries are keyed by a
+// sequence number stored in the handle, so the registry never keeps a handle
+// reachable and its finalizer can still run.
+type registry struct {
+	sync.Mutex
+	seq     uint64
+	entries map[uint64]*MappingInfo
+}
+
+var mappings = &registry{
+	entries: make(map[uint64]*MappingInfo),
+}
+
+func (r *registry) add(info MappingInfo) uint64 {
+	info.Created = time.Now()
+	if DebugLogEnabled() {
+		info.Stack = string(debug.Stack())
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.seq++
+	r.entries[r.seq] = &info
+	return r.seq
+}
+
+func (r *registry) remove(key uint64) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.entries, key)
+}
+
+func (r *registry) resize(key uint64, size int) {
+	r.Lock()
+	defer r.Unlock()
+	if info, ok := r.entries[key]; ok {
+		info.Size = size
+	}
+}
+
+func (r *registry) get(key uint64) (MappingInfo, bool) {
+	r.Lock()
+	defer r.Unlock()
+	info, ok := r.entries[key]
+	if !ok {
+		return MappingInfo{}, false
+	}
+	return *info, true
+}
+
+// Mappings returns the mappings that are currently open, oldest first.
+func Mappings() []MappingInfo {
+	mappings.Lock()
+	defer mappings.Unlock()
+
+	list := make([]MappingInfo, 0, len(mappings.entries))
+	for _, info := range mappings.entries {
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list
+}
+
+// warnLeak reports a mapping that was closed by its finalizer because the
+// user never called Close.
+func warnLeak(l *slog.Logger, key uint64) {
+	info, ok := mappings.get(key)
+	if !ok {
+		return
+	}
+	attrs := []any{"kind", info.Kind, "path", info.Path, "id", info.ID, "size", info.Size}
+	if info.Stack != "" {
+		attrs = append(attrs, "stack", info.Stack)
+	}
+	l.Warn("mapping leaked, closed by finalizer", attrs...)
+}
+
+func finalizeMapFile(f *MapFile) {
+	warnLeak(f.log(), f.reg)
+	_ = f.Close()
+}
+
+func finalizeMapMem(f *MapMem) {
+	warnLeak(f.log(), f.reg)
+	_ = f.Close()
+}
@@ -0,0 +1,89 @@
+package mmap
+
+import (
+	"bytes"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMappings(t *testing.T) {
+	f, err := Open("registry_test.go")
+	if err != nil {
+		t.Fatalf("could not mmap file: %+v", err)
+	}
+	m, err := OpenMem(MapMemKeyInvalid, 0)
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+
+	find := func(kind string, match func(MappingInfo) bool) bool {
+		for _, info := range Mappings() {
+			if info.Kind == kind && match(info) {
+				return true
+			}
+		}
+		return false
+	}
+	if !find("file", func(i MappingInfo) bool { return i.Path == "registry_test.go" && i.Size == f.Len() }) {
+		t.Fatal("file mapping not registered")
+	}
+	if !find("mem", func(i MappingInfo) bool { return i.ID == m.ID() && i.Owner }) {
+		t.Fatal("memory mapping not registered")
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("could not close file: %+v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("could not close memory: %+v", err)
+	}
+	if find("file", func(i MappingInfo) bool { return i.Path == "registry_test.go" }) {
+		t.Fatal("closed file mapping still registered")
+	}
+	if find("mem", func(i MappingInfo) bool { return i.ID == m.ID() }) {
+		t.Fatal("closed memory mapping still registered")
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMappingLeak(t *testing.T) {
+	var out syncBuffer
+	SetLogger(slog.New(slog.NewTextHandler(&out, nil)))
+	defer SetLogger(nil)
+
+	func() {
+		m, err := OpenMem(MapMemKeyInvalid, 0)
+		if err != nil {
+			t.Fatalf("could not create memory: %+v", err)
+		}
+		_ = m.ID()
+	}()
+
+	for i := 0; i < 50 && !strings.Contains(out.String(), "leaked"); i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "mapping leaked") {
+		t.Fatalf("leak was not reported, log:\n%s", out.String())
+	}
+}
@@ -0,0 +1,156 @@
+package mmap
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// DefaultScanChunk is the chunk size Scan uses when given none.
+const DefaultScanChunk = 4 << 20
+
+// ScanFunc processes the chunk of a mapping at off. The chunk aliases the
+// mapping and must not be retained after the function returns.
+type ScanFunc func(off int64, chunk []byte) error
+
+// Scan calls fn on consecutive chunks of the mapping of f from workers
+// goroutines in parallel. Chunks are chunkSize bytes, rounded up to whole
+// pages, except for the last one; a chunkSize of zero or less selects
+// DefaultScanChunk and a workers count of zero or less uses GOMAXPROCS.
+// Pages are requested with AdviceWillNeed before a chunk is handed out;
+// calling Advise(AdviceSequential) first helps read-ahead further.
+//
+// The first error returned by fn, or the error of ctx, stops the scan and
+// is returned. In guarded mode a fault in fn is returned as ErrTruncated or
+// ErrIO, but the mapping is not remapped. f must not be remapped or closed
+// during the scan.
+func (f *MapFile) Scan(ctx context.Context, chunkSize, workers int, fn ScanFunc) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultScanChunk
+	}
+	chunkSize = roundUp(chunkSize, pageSize)
+	return f.scan(ctx, "Scan", workers, fn, func(data []byte, start int) int {
+		return min(start+chunkSize, len(data))
+	})
+}
+
+// ScanRecords is like Scan, but moves the end of every chunk but the last
+// one past the next delim, so records separated by delim, such as lines,
+// are never split between chunks. Chunks then no longer start on page
+// boundaries.
+func (f *MapFile) ScanRecords(ctx context.Context, chunkSize, workers int, delim byte, fn ScanFunc) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultScanChunk
+	}
+	return f.scan(ctx, "ScanRecords", workers, fn, func(data []byte, start int) int {
+		end := min(start+chunkSize, len(data))
+		if end == len(data) {
+			return end
+		}
+		if i := bytes.IndexByte(data[end-1:], delim); i >= 0 {
+			return end + i
+		}
+		return len(data)
+	})
+}
+
+type scanChunk struct {
+	off, end int
+}
+
+// scan hands the chunks of f delimited by split to workers calling fn.
+// split returns the end of the chunk starting at start.
+func (f *MapFile) scan(ctx context.Context, op string, workers int, fn ScanFunc, split func(data []byte, start int) int) error {
+	if f == nil {
+		return &MapError{Op: "MapFile." + op, Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return f.error(op, 0, 0, ErrClosed)
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	data := f.data
+	chunks := make(chan scanChunk)
+	var wg sync.WaitGroup
+	for range min(workers, len(data)/pageSize+1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				if ctx.Err() != nil {
+					continue
+				}
+				start := c.off &^ (pageSize - 1)
+				_ = advise(data[start:c.end], AdviceWillNeed, false)
+				if err := f.scanChunk(op, fn, data, c); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	for start := 0; start < len(data); {
+		end := split(data, start)
+		select {
+		case chunks <- scanChunk{off: start, end: end}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		start = end
+	}
+	close(chunks)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// scanChunk calls fn on chunk c of data, recovering faults in guarded mode.
+func (f *MapFile) scanChunk(op string, fn ScanFunc, data []byte, c scanChunk) (err error) {
+	if f.guarded {
+		old := debug.SetPanicOnFault(true)
+		defer func() {
+			debug.SetPanicOnFault(old)
+			r := recover()
+			if r == nil {
+				return
+			}
+			if _, ok := r.(interface{ Addr() uintptr }); !ok {
+				panic(r)
+			}
+			err = f.error(op, int64(c.off), c.end-c.off, scanFault(f.fd, f.offset+int64(c.end)))
+		}()
+	}
+	return fn(int64(c.off), data[c.off:c.end])
+}
+
+// scanFault tells whether a fault below end was caused by the truncation
+// of fd, without remapping.
+func scanFault(fd *os.File, end int64) error {
+	if fi, err := fd.Stat(); err == nil && fi.Size() < end {
+		return ErrTruncated
+	}
+	return ErrIO
+}
@@ -0,0 +1,79 @@
+package mmap_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func TestScan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	var content bytes.Buffer
+	for i := range 50000 {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	if err := os.WriteFile(path, content.Bytes(), 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+
+	var total, chunks atomic.Int64
+	err = f.Scan(context.Background(), 10000, 4, func(off int64, chunk []byte) error {
+		if off%int64(os.Getpagesize()) != 0 {
+			t.Errorf("chunk at %d is not page aligned", off)
+		}
+		total.Add(int64(len(chunk)))
+		chunks.Add(1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not scan: %+v", err)
+	}
+	if got, want := total.Load(), int64(content.Len()); got != want {
+		t.Fatalf("invalid total: got=%d, want=%d", got, want)
+	}
+
+	var mu sync.Mutex
+	lines := 0
+	err = f.ScanRecords(context.Background(), 10000, 4, '\n', func(off int64, chunk []byte) error {
+		if chunk[len(chunk)-1] != '\n' || (off > 0 && content.Bytes()[off-1] != '\n') {
+			t.Errorf("chunk at %d splits a line", off)
+		}
+		mu.Lock()
+		lines += bytes.Count(chunk, []byte("\n"))
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not scan: %+v", err)
+	}
+	if got, want := lines, 50000; got != want {
+		t.Fatalf("invalid line count: got=%d, want=%d", got, want)
+	}
+
+	errStop := errors.New("stop")
+	err = f.Scan(context.Background(), 0, 0, func(off int64, chunk []byte) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, errStop)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := f.Scan(ctx, 0, 0, func(int64, []byte) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,104 @@
+package mmap
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	// shmKeyPrefix marks the SysV keys of the segments created by this
+	// package, so Segments can tell them apart from those of other programs.
+	shmKeyPrefix = 0x4d4d << 16 // "MM"
+	shmKeyMask   = 0xffff << 16
+	// shmKeyTries bounds the attempts to find a free key.
+	shmKeyTries = 16
+)
+
+// shmKey returns a random SysV key in the key space of this package.
+func shmKey() int {
+	return shmKeyPrefix | GenKey()&^shmKeyMask
+}
+
+// Segment describes a SysV shared memory segment.
+type Segment struct {
+	ID   int
+	Key  int
+	Size int
+	Mode os.FileMode
+	UID  int
+	GID  int
+	// CreatorPID is the process that created the segment, LastPID the last
+	// one that attached or detached it.
+	CreatorPID int
+	LastPID    int
+	// Attached is the number of processes attached to the segment.
+	Attached int
+	Changed  time.Time
+	// Managed reports whether the segment was created by this package.
+	Managed bool
+}
+
+// Identify returns the name of the format of the package stored at the
+// start of b: "segment" for a segment header, "hashmap", "btree", "bloom"
+// or "arena", or "" when b holds none of them.
+func Identify(b []byte) string {
+	if len(b) < 8 {
+		return ""
+	}
+	switch binary.LittleEndian.Uint32(b) {
+	case segmentMagic:
+		return "segment"
+	case hashMapMagic:
+		return "hashmap"
+	case bloomMagic:
+		return "bloom"
+	case arenaMagic:
+		return "arena"
+	}
+	if len(b) >= btreePageHeader+8 &&
+		binary.LittleEndian.Uint16(b) == btreeFlagMeta &&
+		binary.LittleEndian.Uint32(b[btreePageHeader:]) == btreeMagic {
+		return "btree"
+	}
+	return ""
+}
+
+// Orphans lists the segments created by this package whose creating
+// process is no longer running, such as those left behind by a crash. As
+// process ids are reused, a segment whose creator's id now belongs to
+// another process is not reported.
+func Orphans() ([]Segment, error) {
+	segs, err := Segments()
+	if err != nil {
+		return nil, err
+	}
+	var orphans []Segment
+	for _, s := range segs {
+		if s.Managed && !processAlive(s.CreatorPID) {
+			orphans = append(orphans, s)
+		}
+	}
+	return orphans, nil
+}
+
+// RemoveOrphans removes the segments reported by Orphans and returns them.
+// Processes still attached to an orphan keep using it until they detach.
+// Call it at startup to reclaim the segments of crashed processes.
+func RemoveOrphans() ([]Segment, error) {
+	orphans, err := Orphans()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	removed := orphans[:0]
+	for _, s := range orphans {
+		if err := RemoveSegment(s.ID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, s)
+	}
+	return removed, errors.Join(errs...)
+}
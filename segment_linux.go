@@ -0,0 +1,65 @@
+package mmap
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sysvShmPath = "/proc/sysvipc/shm"
+
+// Segments lists the SysV shared memory segments of the system, as far as
+// the caller may see them.
+func Segments() ([]Segment, error) {
+	f, err := os.Open(sysvShmPath)
+	if err != nil {
+		return nil, &MapError{Op: "Segments", Path: sysvShmPath, Err: underlyingError(err)}
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		return nil, &MapError{Op: "Segments", Path: sysvShmPath, Err: ErrInvalidFormat}
+	}
+	columns := make(map[string]int)
+	for i, name := range strings.Fields(s.Text()) {
+		columns[name] = i
+	}
+	for _, name := range []string{"key", "shmid", "perms", "size", "cpid", "lpid", "nattch", "uid", "gid", "ctime"} {
+		if _, ok := columns[name]; !ok {
+			return nil, &MapError{Op: "Segments", Path: sysvShmPath, Err: ErrInvalidFormat}
+		}
+	}
+
+	var segs []Segment
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < len(columns) {
+			continue
+		}
+		num := func(name string, base int) int {
+			n, _ := strconv.ParseInt(fields[columns[name]], base, 64)
+			return int(n)
+		}
+		seg := Segment{
+			ID:         num("shmid", 10),
+			Key:        num("key", 10),
+			Size:       num("size", 10),
+			Mode:       os.FileMode(num("perms", 8)) & os.ModePerm,
+			UID:        num("uid", 10),
+			GID:        num("gid", 10),
+			CreatorPID: num("cpid", 10),
+			LastPID:    num("lpid", 10),
+			Attached:   num("nattch", 10),
+			Changed:    time.Unix(int64(num("ctime", 10)), 0),
+		}
+		seg.Managed = seg.Key&shmKeyMask == shmKeyPrefix
+		segs = append(segs, seg)
+	}
+	if err := s.Err(); err != nil {
+		return nil, &MapError{Op: "Segments", Path: sysvShmPath, Err: underlyingError(err)}
+	}
+	return segs, nil
+}
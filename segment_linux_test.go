@@ -0,0 +1,75 @@
+//go:build linux
+
+package mmap_test
+
+import (
+	"testing"
+
+	"github.com/godcong/mmap"
+)
+
+func findSegment(t *testing.T, id int) (mmap.Segment, bool) {
+	t.Helper()
+	segs, err := mmap.Segments()
+	if err != nil {
+		t.Fatalf("could not list segments: %+v", err)
+	}
+	for _, s := range segs {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return mmap.Segment{}, false
+}
+
+func TestSegments(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(8192))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	defer m.Close()
+
+	s, ok := findSegment(t, m.ID())
+	if !ok {
+		t.Fatalf("segment %d not listed", m.ID())
+	}
+	if !s.Managed || s.Size != 8192 || s.Attached < 1 || s.Mode != 0o600 {
+		t.Fatalf("invalid segment: %+v", s)
+	}
+
+	if _, err := mmap.NewArena(m); err != nil {
+		t.Fatalf("could not create arena: %+v", err)
+	}
+	b := make([]byte, 128)
+	if _, err := m.ReadAt(b, 0); err != nil {
+		t.Fatalf("could not read: %+v", err)
+	}
+	if got, want := mmap.Identify(b), "arena"; got != want {
+		t.Fatalf("invalid format: got=%q, want=%q", got, want)
+	}
+	if got := mmap.Identify(make([]byte, 128)); got != "" {
+		t.Fatalf("invalid format: got=%q, want none", got)
+	}
+}
+
+func TestRemoveSegment(t *testing.T) {
+	m, err := mmap.OpenMemWith(mmap.WithSize(4096))
+	if err != nil {
+		t.Fatalf("could not create memory: %+v", err)
+	}
+	id := m.ID()
+	if err := mmap.RemoveSegment(id); err != nil {
+		t.Fatalf("could not remove segment: %+v", err)
+	}
+	// The segment lives on until its last process detaches.
+	if _, err := m.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatalf("could not write: %+v", err)
+	}
+	_ = m.Close()
+	if _, ok := findSegment(t, id); ok {
+		t.Fatalf("segment %d still listed", id)
+	}
+	if err := mmap.RemoveSegment(id); err == nil {
+		t.Fatalf("removed segment %d twice", id)
+	}
+}
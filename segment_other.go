@@ -0,0 +1,8 @@
+//go:build !linux
+
+package mmap
+
+// Segments is only supported on Linux.
+func Segments() ([]Segment, error) {
+	return nil, &MapError{Op: "Segments", Err: ErrUnsupported}
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd
+
+package mmap
+
+import (
+	syscall "golang.org/x/sys/unix"
+)
+
+// RemoveSegment marks the SysV segment id for removal. The system frees it
+// once the last process detaches.
+func RemoveSegment(id int) error {
+	if err := closeShm(id)(); err != nil {
+		return &MapError{Op: "RemoveSegment", ID: id, Err: err}
+	}
+	return nil
+}
+
+// processAlive reports whether the process pid is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,28 @@
+package mmap
+
+import (
+	syscall "golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of a running process.
+const stillActive = 259
+
+// RemoveSegment is unsupported on Windows, where named memory goes away
+// with its last handle.
+func RemoveSegment(id int) error {
+	return &MapError{Op: "RemoveSegment", ID: id, Err: ErrUnsupported}
+}
+
+// processAlive reports whether the process pid is running.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
@@ -0,0 +1,200 @@
+package mmap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// watchInterval is how often Watch polls the size of a file where it cannot
+// be notified of changes.
+const watchInterval = 100 * time.Millisecond
+
+// WatchEvent reports a change of the size of a watched file.
+type WatchEvent struct {
+	// Size is the size of the file from the offset of the mapping.
+	Size int64
+	// Err ends the watch, for example when the file was closed.
+	Err error
+}
+
+// Watch reports the changes of the size of the file of f, as another
+// process appends to or truncates it, until ctx is done or f is closed. It
+// uses inotify on Linux and polls the file elsewhere. Events are coalesced,
+// so a slow receiver only sees the latest size. The channel is closed when
+// the watch ends.
+//
+// As MapFile is not safe for concurrent use, the watch does not remap f
+// itself: it marks the mapping stale, and the next access through the
+// Read, Write, At or View methods remaps it from the goroutine using f,
+// unless f is private. Len and Bytes keep reporting the old mapping until
+// then; call Refresh to remap at once.
+func (f *MapFile) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	if f == nil {
+		return nil, &MapError{Op: "MapFile.Watch", Err: ErrInvalid}
+	}
+	if f.data == nil {
+		return nil, f.error("Watch", 0, 0, ErrClosed)
+	}
+	fi, err := f.fd.Stat()
+	if err != nil {
+		return nil, f.error("Watch", 0, 0, underlyingError(err))
+	}
+	wake, stop := notifyChanges(f.path)
+	if wake == nil {
+		f.logOp(slog.LevelDebug, "Watch", "mode", "poll")
+	}
+	if f.closing == nil {
+		f.closing = make(chan struct{})
+	}
+
+	events := make(chan WatchEvent, 1)
+	w := &sizeWatch{fd: f.fd, offset: f.offset, stale: &f.stale, closing: f.closing}
+	go w.run(ctx, max(fi.Size()-f.offset, 0), wake, stop, events)
+	return events, nil
+}
+
+// sizeWatch holds what the watch of a MapFile needs, so that it does not
+// race with the goroutine using the file.
+type sizeWatch struct {
+	fd      *os.File
+	offset  int64
+	stale   *atomic.Bool
+	closing <-chan struct{}
+}
+
+// run sends to events the size of the file whenever it differs from last,
+// checking it whenever wake fires, or every watchInterval when wake is nil
+// or closed. It calls stop when the watch ends.
+func (w *sizeWatch) run(ctx context.Context, last int64, wake <-chan struct{}, stop func(), events chan WatchEvent) {
+	defer close(events)
+	defer stop()
+	var tick <-chan time.Time
+	if wake == nil {
+		t := time.NewTicker(watchInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.closing:
+			sendLatest(events, WatchEvent{Err: ErrClosed})
+			return
+		case _, ok := <-wake:
+			if !ok {
+				wake = nil
+				t := time.NewTicker(watchInterval)
+				defer t.Stop()
+				tick = t.C
+			}
+		case <-tick:
+		}
+
+		fi, err := w.fd.Stat()
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				err = ErrClosed
+			}
+			sendLatest(events, WatchEvent{Err: underlyingError(err)})
+			return
+		}
+		if size := max(fi.Size()-w.offset, 0); size != last {
+			last = size
+			w.stale.Store(true)
+			sendLatest(events, WatchEvent{Size: size})
+		}
+	}
+}
+
+// stopWatches ends the watches of f as it is closed.
+func (f *MapFile) stopWatches() {
+	if f.closing != nil {
+		close(f.closing)
+		f.closing = nil
+	}
+}
+
+// sendLatest sends e to events, replacing an event nobody received yet.
+func sendLatest(events chan WatchEvent, e WatchEvent) {
+	for {
+		select {
+		case events <- e:
+			return
+		default:
+		}
+		select {
+		case <-events:
+		default:
+		}
+	}
+}
+
+// Follow returns a reader of f from its current offset that, like tail -f,
+// waits for the file to grow at the end of the mapping instead of returning
+// io.EOF, and remaps f as it grows. Once ctx is done or the reader is
+// closed, reads return an error. Closing the reader stops its watch but
+// leaves f open. f must not be used by other goroutines while reading.
+func (f *MapFile) Follow(ctx context.Context) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	return &follower{f: f, ctx: ctx, cancel: cancel}
+}
+
+type follower struct {
+	f      *MapFile
+	ctx    context.Context
+	cancel context.CancelFunc
+	events <-chan WatchEvent
+}
+
+func (r *follower) Close() error {
+	r.cancel()
+	return nil
+}
+
+func (r *follower) Read(p []byte) (int, error) {
+	f := r.f
+	for {
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := f.Read(p)
+		if n > 0 || err != io.EOF || len(p) == 0 {
+			return n, err
+		}
+
+		// Start watching before checking the size again, so no growth
+		// between the check and the wait goes unnoticed.
+		if r.events == nil {
+			if r.events, err = f.Watch(r.ctx); err != nil {
+				return 0, err
+			}
+		}
+		if err := f.refresh("Follow"); err != nil {
+			return 0, err
+		}
+		if f.off < len(f.data) {
+			continue
+		}
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case e, ok := <-r.events:
+			if !ok {
+				r.events = nil
+				if err := r.ctx.Err(); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			if e.Err != nil {
+				return 0, f.error("Follow", int64(f.off), 0, e.Err)
+			}
+		}
+	}
+}
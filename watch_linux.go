@@ -0,0 +1,43 @@
+package mmap
+
+import (
+	"os"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+// notifyChanges returns a channel that fires when path is modified, using
+// inotify, and a function that stops the notifications. It returns a nil
+// channel when inotify is not available, and closes the channel when stop
+// is called or inotify fails.
+func notifyChanges(path string) (<-chan struct{}, func()) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, func() {}
+	}
+	mask := uint32(syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+		syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF)
+	if _, err := syscall.InotifyAddWatch(fd, path, mask); err != nil {
+		_ = syscall.Close(fd)
+		return nil, func() {}
+	}
+	// A non-blocking descriptor is served by the runtime poller, so closing
+	// the file interrupts a pending read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	wake := make(chan struct{}, 1)
+	go func() {
+		defer close(wake)
+		buf := make([]byte, 4096)
+		for {
+			if _, err := f.Read(buf); err != nil {
+				return
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return wake, func() { _ = f.Close() }
+}
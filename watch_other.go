@@ -0,0 +1,8 @@
+//go:build !linux
+
+package mmap
+
+// notifyChanges returns a nil channel, so Watch polls the file.
+func notifyChanges(path string) (<-chan struct{}, func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,108 @@
+package mmap_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/godcong/mmap"
+)
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := f.Watch(ctx)
+	if err != nil {
+		t.Fatalf("could not watch: %+v", err)
+	}
+
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer w.Close()
+	if _, err := w.WriteString(" world"); err != nil {
+		t.Fatalf("could not append: %+v", err)
+	}
+	e := <-events
+	if e.Err != nil || e.Size != 11 {
+		t.Fatalf("invalid event: %+v", e)
+	}
+	// The next read remaps the file.
+	buf := make([]byte, 11)
+	if n, err := f.ReadAt(buf, 0); err != nil || string(buf[:n]) != "hello world" {
+		t.Fatalf("invalid read: %q, %+v", buf[:n], err)
+	}
+	if got, want := f.Len(), 11; got != want {
+		t.Fatalf("invalid length: got=%d, want=%d", got, want)
+	}
+
+	// Closing the file ends the watch.
+	if err := f.Close(); err != nil {
+		t.Fatalf("could not close: %+v", err)
+	}
+	var last mmap.WatchEvent
+	for e := range events {
+		last = e
+	}
+	if !errors.Is(last.Err, mmap.ErrClosed) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", last.Err, mmap.ErrClosed)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	f, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer f.Close()
+
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("could not open file: %+v", err)
+	}
+	defer w.Close()
+	go func() {
+		for _, s := range []string{"one ", "two ", "three"} {
+			time.Sleep(20 * time.Millisecond)
+			_, _ = w.WriteString(s)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := f.Follow(ctx)
+	buf := make([]byte, len("one two three"))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("could not follow: %+v", err)
+	}
+	if got, want := string(buf), "one two three"; got != want {
+		t.Fatalf("invalid content: got=%q, want=%q", got, want)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = r.Close()
+	}()
+	if _, err := r.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("invalid error:\ngot= %+v\nwant=%+v", err, context.Canceled)
+	}
+}